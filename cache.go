@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Successful hook results keyed by hook and the tree of index
+// Stored as empty files named by key under git dir
+type hookCache struct {
+	dir string
+}
+
+// Find cache of trigger, nil if disabled
+// Only pre-commit hooks are cached, their result depend on index only
+func getCache(configs map[string]string, trigger string) *hookCache {
+	enabled := trigger == "pre-commit" && getFlag(configs, trigger, "cache", func(options *triggerConfig) *bool {
+		return options.Cache
+	})
+	if !enabled {
+		return nil
+	}
+
+	dir, err := getCacheDir()
+	if err != nil {
+		return nil
+	}
+	return &hookCache{dir: dir}
+}
+
+func getCacheDir() (string, error) {
+	gitDir, err := getAbsGitDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, CACHE_DIRNAME), nil
+}
+
+// Tree of index identifying staged content, empty if unavailable
+// `git write-tree` lock the index, never call it while other hooks may touch it
+func getIndexTree() string {
+	tree, err := gitExec("write-tree")
+	if err != nil {
+		return ""
+	}
+	return tree
+}
+
+// Identify hook run by its scope, name, content and arguments,
+// the staged files it receive and the tree of index
+// Return empty string if hook can't be identified
+func (cache *hookCache) key(job *hookJob, args []string, tree string) string {
+	if tree == "" {
+		return ""
+	}
+
+	content, err := ioutil.ReadFile(job.path)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{
+		job.scope,
+		job.name,
+		fmt.Sprintf("%x", sha256.Sum256(content)),
+		strings.Join(args, "\x00"),
+		strings.Join(job.files, "\x00"),
+		tree,
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+func (cache *hookCache) has(key string) bool {
+	isExist, _ := exists(filepath.Join(cache.dir, key))
+	return isExist
+}
+
+func (cache *hookCache) add(key string) error {
+	if err := os.MkdirAll(cache.dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cache.dir, key), nil, 0644)
+}
+
+// Remove cached hook results of current repo
+func clearCache() {
+	dir, err := getCacheDir()
+	if err != nil {
+		logger.Errorln(MESSAGES["NotGitRepo"])
+		return
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Errorln(err)
+		return
+	}
+	logger.Infoln(MESSAGES["CacheCleared"])
+}
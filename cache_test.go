@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Count how many times hook executed
+func countRuns(t *testing.T) int {
+	out, err := ioutil.ReadFile(".git/runs")
+	if err != nil {
+		return 0
+	}
+	return strings.Count(string(out), "\n")
+}
+
+func TestRunCache(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		git config hooks.cache true;
+		echo one > a.txt;
+		git add a.txt;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "count", `echo run >> .git/runs`)
+
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 1, countRuns(t))
+
+		// same index
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 1, countRuns(t))
+		assert.Contains(t, logger.infos, "Skip pre-commit/count, passed before")
+
+		// index changed
+		err = exec.Command("bash", "-c", "echo two > a.txt; git add a.txt").Run()
+		assert.Nil(t, err)
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 2, countRuns(t))
+
+		// hook changed
+		createHook(t, "githooks", "pre-commit", "count", `echo run >> .git/runs # changed`)
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 3, countRuns(t))
+
+		// other triggers never cached
+		createHook(t, "githooks", "commit-msg", "count", `echo run >> .git/runs`)
+		runTrusted(t, "commit-msg")
+		runTrusted(t, "commit-msg")
+		assert.Equal(t, 5, countRuns(t))
+
+		// clear cache
+		clearCache()
+		assert.Contains(t, logger.infos, MESSAGES["CacheCleared"])
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 6, countRuns(t))
+		logger.clear()
+	})
+
+	// failed hook not cached
+	createGitRepo(t, func(tempdir string) {
+		err := exec.Command("git", "config", "hooks.cache", "true").Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "fail", `echo run >> .git/runs; exit 1`)
+
+		runTrusted(t, "pre-commit")
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 2, countRuns(t))
+		logger.clear()
+	})
+
+	// disabled by default
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "count", `echo run >> .git/runs`)
+
+		runTrusted(t, "pre-commit")
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 2, countRuns(t))
+		logger.clear()
+	})
+}
+
+func TestRunCacheParallel(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		git config hooks.cache true;
+		git config hooks.parallel 8;
+		echo one > a.txt;
+		git add a.txt;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+		for i := 0; i < 30; i++ {
+			createHook(t, "githooks", "pre-commit", fmt.Sprintf("count%d", i), `echo run >> .git/runs`)
+		}
+
+		// every hook identified by the same tree, computed once
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, 30, countRuns(t))
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 30, countRuns(t))
+		logger.clear()
+	})
+
+	// tree recomputed after fix hook re-stage files
+	createGitRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		git config hooks.cache true;
+		echo one > a.txt;
+		git add a.txt;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+		createHook(t, tempdir, "pre-commit", "fmt", `echo fixed > a.txt; echo fmt >> .git/runs`)
+		createHook(t, tempdir, "pre-commit", "lint", `echo lint >> .git/runs`)
+		jobs := func() []*hookJob {
+			jobs, err := sortJobs([]*hookJob{
+				{scope: "user", id: "fmt", name: "fmt", path: filepath.Join(tempdir, "pre-commit", "fmt"), fix: true},
+				{scope: "user", id: "lint", name: "lint", path: filepath.Join(tempdir, "pre-commit", "lint"), after: []string{"fmt"}},
+			})
+			assert.Nil(t, err)
+			return jobs
+		}
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		before := r.tree
+		r.execute(jobs())
+		assert.False(t, r.failed)
+		assert.NotEqual(t, before, r.tree)
+		assert.Equal(t, getIndexTree(), r.tree)
+		assert.Equal(t, 2, countRuns(t))
+
+		// fix hook passed on changed index is run again, lint passed on fixed index
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		r.execute(jobs())
+		assert.Equal(t, 3, countRuns(t))
+		assert.Contains(t, logger.infos, "Skip lint, passed before")
+
+		// nothing to fix any more
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		r.execute(jobs())
+		assert.Equal(t, 3, countRuns(t))
+		logger.clear()
+	})
+}
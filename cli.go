@@ -11,11 +11,13 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -30,12 +32,51 @@ func main() {
 			Name:      "install",
 			ShortName: "i",
 			Usage:     "Install git-hooks in this repo",
-			Action:    bind(install, true),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "hooks-path",
+					Usage: "Install via core.hooksPath instead of replacing hooks directory",
+				},
+				cli.BoolFlag{
+					Name:  "global",
+					Usage: "Install via global core.hooksPath, take effect in every repo",
+				},
+				cli.BoolFlag{
+					Name:  "recursive",
+					Usage: "Install into submodules too",
+				},
+			},
+			Action: func(c *cli.Context) {
+				installer := func() { install(true) }
+				if c.Bool("hooks-path") {
+					installer = func() { installHooksPath(false) }
+				}
+
+				if c.Bool("global") {
+					installHooksPath(true)
+				} else if c.Bool("recursive") {
+					installRecursive(installer)
+				} else {
+					installer()
+				}
+			},
 		},
 		{
-			Name:   "uninstall",
-			Usage:  "Restore previous hooks",
-			Action: bind(uninstall),
+			Name:  "uninstall",
+			Usage: "Restore previous hooks",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "global",
+					Usage: "Uninstall global core.hooksPath",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if c.Bool("global") {
+					uninstallHooksPath(true)
+				} else {
+					uninstall()
+				}
+			},
 		},
 		{
 			Name:  "install-global",
@@ -73,6 +114,74 @@ func main() {
 				run(c.Args()...)
 			},
 		},
+		{
+			Name:  "disable",
+			Usage: "Disable hooks in this repo, like `git hooks disable pre-commit/golint`",
+			Action: func(c *cli.Context) {
+				disable(c.Args()...)
+			},
+		},
+		{
+			Name:  "enable",
+			Usage: "Enable hooks disabled by `git hooks disable`",
+			Action: func(c *cli.Context) {
+				enable(c.Args()...)
+			},
+		},
+		{
+			Name:  "cache",
+			Usage: "Manage cached hook results",
+			Subcommands: []cli.Command{
+				{
+					Name:   "clear",
+					Usage:  "Remove cached hook results of this repo",
+					Action: bind(clearCache),
+				},
+			},
+		},
+		{
+			Name:   "trust",
+			Usage:  "Trust project hooks after review, they are skipped until trusted",
+			Action: bind(trust),
+		},
+		{
+			Name:   "lock",
+			Usage:  "Record commits of contrib repos in githooks.lock",
+			Action: bind(lock),
+		},
+		{
+			Name:  "contrib",
+			Usage: "Manage contrib repos cloned by git-hooks",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "Show contrib repos with their size, revision and last used time",
+					Action: bind(listContrib),
+				},
+				{
+					Name:  "prune",
+					Usage: "Remove contrib repos no config reference, or not used within age, like `git hooks contrib prune 720h`",
+					Action: func(c *cli.Context) {
+						pruneContrib(c.Args()...)
+					},
+				},
+			},
+		},
+		{
+			Name:   "fetch",
+			Usage:  "Clone and fetch contrib repos of current configs, so hooks can run offline",
+			Action: bind(fetch),
+		},
+		{
+			Name:   "autoupdate",
+			Usage:  "Pin contrib repos in githooks.json to their newest tags",
+			Action: bind(autoupdate),
+		},
+		{
+			Name:   "doctor",
+			Usage:  "Diagnose why hooks don't fire and suggest fixes",
+			Action: bind(doctor),
+		},
 		{
 			Name:      "identity",
 			ShortName: "id",
@@ -94,93 +203,291 @@ func list() {
 	} else {
 		logger.Infoln(MESSAGES["NotInstalled"])
 	}
+	if hooksPath, err := gitExec("config --get core.hooksPath"); err == nil {
+		logger.Infoln(MESSAGES["HooksPath"] + hooksPath)
+	}
+
+	disabled := getDisabledHooks()
+	// hooks installed before git-hooks, listed by trigger
+	legacy := make(map[string][]string)
+	for _, dir := range legacyHookDirs() {
+		for trigger := range listLegacyHooks(dir) {
+			legacy[trigger] = append(legacy[trigger], filepath.Base(dir))
+		}
+	}
+	if len(legacy) != 0 {
+		logger.Infoln("legacy hooks")
+		for _, trigger := range sortedTriggers(legacy) {
+			logger.Infoln("  " + trigger)
 
-	for scope, dir := range hookDirs() {
-		logger.Infoln(scope + " hooks")
+			for _, hook := range legacy[trigger] {
+				logger.Infoln("    - " + hook + disabledMark(disabled, trigger, hook))
+			}
+		}
+		logger.Infoln()
+	}
+
+	trusted := isProjectTrusted()
+	dirs := hookDirs()
+	for _, scope := range SCOPES {
+		dir, ok := dirs[scope]
+		if !ok {
+			continue
+		}
+		logger.Infoln(scope + " hooks" + trustMark(scope, trusted))
 
 		config, err := listHooksInDir(scope, dir)
 		if err != nil {
 			continue
 		}
 
-		for trigger, hooks := range config {
+		for _, trigger := range sortedTriggers(config) {
 			logger.Infoln("  " + trigger)
 
-			for _, hook := range hooks {
-				logger.Infoln("    - " + hook)
+			for _, hook := range config[trigger] {
+				logger.Infoln("    - " + hook + disabledMark(disabled, trigger, hook))
 			}
 		}
 		logger.Infoln()
 	}
 
 	logger.Infoln("Contrib hooks")
-	for scope, configPath := range hookConfigs() {
-		logger.Infoln(scope + " hooks")
+	configs := hookConfigs()
+	for _, scope := range SCOPES {
+		configPath, ok := configs[scope]
+		if !ok {
+			continue
+		}
+		logger.Infoln(scope + " hooks" + trustMark(scope, trusted))
 
 		config, err := listHooksInConfig(configPath)
 		if err != nil {
-			continue
+			logger.Errorln(escapeColor(err.Error()))
+			return
 		}
 
-		for trigger, repo := range config {
+		for _, trigger := range sortedTriggers(config) {
 			logger.Infoln("  " + trigger)
 
-			for repoName, hooks := range repo {
-				logger.Infoln("  " + repoName)
+			for _, repo := range config[trigger].Repos {
+				logger.Infoln("  " + escapeColor(repo.String()))
 
-				for _, hook := range hooks {
-					logger.Infoln("    - " + hook)
+				for _, hook := range repo.Hooks {
+					logger.Infoln("    - " + hook.Name + disabledMark(disabled, trigger, hook.Name))
 				}
 			}
 		}
 	}
 }
 
+// Mark project hooks not trusted yet in list
+func trustMark(scope string, trusted bool) string {
+	if scope == "project" && !trusted {
+		return " (untrusted)"
+	}
+	return ""
+}
+
+// Disable hooks in current repo
+// Hooks specified as <trigger>/<hook> and stored in local git config
+func disable(hooks ...string) {
+	for _, hook := range hooks {
+		if !isValidHook(hook) {
+			logger.Errorln(MESSAGES["InvalidHook"])
+			return
+		}
+		if isDisabled(getDisabledHooks(), "", hook) {
+			continue
+		}
+
+		if _, err := gitExec(GIT["DisableHook"] + hook); err != nil {
+			logger.Errorln(MESSAGES["NotGitRepo"])
+			return
+		}
+		logger.Infoln(MESSAGES["Disabled"] + hook)
+	}
+}
+
+// Enable hooks disabled by `disable`
+func enable(hooks ...string) {
+	for _, hook := range hooks {
+		if !isValidHook(hook) {
+			logger.Errorln(MESSAGES["InvalidHook"])
+			return
+		}
+		if !isDisabled(getDisabledHooks(), "", hook) {
+			continue
+		}
+
+		if _, err := gitExec(GIT["EnableHook"] + "^" + regexp.QuoteMeta(hook) + "$"); err != nil {
+			logger.Errorln(err)
+			return
+		}
+		logger.Infoln(MESSAGES["Enabled"] + hook)
+	}
+}
+
+// Hook specified as <trigger>/<hook>
+func isValidHook(hook string) bool {
+	parts := strings.SplitN(hook, "/", 2)
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+// List hooks disabled in current repo
+func getDisabledHooks() []string {
+	out, err := gitExec(GIT["DisabledHooks"])
+	if err != nil || out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// List hooks skipped by environment variable
+func getSkippedHooks() []string {
+	skips := make([]string, 0)
+	for _, hook := range strings.Split(os.Getenv(ENV_SKIP), ",") {
+		if hook = strings.TrimSpace(hook); hook != "" {
+			skips = append(skips, hook)
+		}
+	}
+	return skips
+}
+
+// Whether hook of trigger is disabled
+// Semi scope trigger like `_pre-commit` share disabled hooks with `pre-commit`
+func isDisabled(disabled []string, trigger, hook string) bool {
+	if trigger != "" {
+		hook = strings.TrimPrefix(trigger, "_") + "/" + hook
+	}
+	for _, item := range disabled {
+		if item == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether hook is referred by any of names,
+// either by hook name, displayed name or <trigger>/<hook>
+func matchHook(names []string, trigger string, job *hookJob) bool {
+	for _, name := range names {
+		if name == job.id || name == job.name || name == trigger+"/"+job.id {
+			return true
+		}
+	}
+	return false
+}
+
+func disabledMark(disabled []string, trigger, hook string) string {
+	if isDisabled(disabled, trigger, hook) {
+		return " (disabled)"
+	}
+	return ""
+}
+
 // If git-hooks installed in the current git repo
 // If current directory is not a git repo, err will be not `nil`
 func isInstalled() (installed bool, err error) {
 	installed = false
 
-	root, err := getGitRepoRoot()
+	hooks, err := getHooksDir()
 	if err != nil {
 		return
 	}
 
-	preCommitHook := filepath.Join(root, ".git/hooks/pre-commit")
-	hook, readErr := ioutil.ReadFile(preCommitHook)
-	installed = readErr == nil && strings.EqualFold(string(hook), tplPostInstall)
+	installed = isShim(filepath.Join(hooks, "pre-commit"), tplPostInstall)
 	return
 }
 
+// Whether hook file is a shim written from template
+func isShim(path string, template string) bool {
+	hook, err := ioutil.ReadFile(path)
+	return err == nil && strings.EqualFold(string(hook), template)
+}
+
 // Install git-hook into current git repo
+// Hooks directory is shared by linked worktrees, so install into common git dir
 func install(isInstall bool) {
-	dirPath, err := getGitDirPath()
+	dirPath, err := getGitCommonDirPath()
 	if err != nil {
 		logger.Errorln(MESSAGES["NotGitRepo"])
 		return
 	}
 
+	hooks := filepath.Join(dirPath, "hooks")
+	// repo created without hooks directory has no hooks.old after install
+	installed := isShim(filepath.Join(hooks, "pre-commit"), tplPostInstall)
+	isExist, _ := exists(filepath.Join(dirPath, "hooks.old"))
 	if isInstall {
-		isExist, _ := exists(filepath.Join(dirPath, "hooks.old"))
+		if installed {
+			// already installed, add shims of triggers supported since last install
+			if err := writeShims(hooks, tplPostInstall); err != nil {
+				logger.Errorln(err)
+			}
+			return
+		}
 		if isExist {
 			logger.Errorln(MESSAGES["ExistHooks"])
 			return
 		}
-		installInto(dirPath, tplPostInstall)
+		if err := installInto(dirPath, tplPostInstall); err != nil {
+			logger.Errorln(err)
+			return
+		}
+		if hooksPath, err := gitExec("config --get core.hooksPath"); err == nil {
+			logger.Warnln(MESSAGES["HooksPathIgnored"] + hooksPath)
+		}
 	} else {
-		isExist, _ := exists(filepath.Join(dirPath, "hooks.old"))
-		if !isExist {
+		if !isExist && !installed {
 			logger.Errorln(MESSAGES["NotExistHooks"])
 			return
 		}
-		os.RemoveAll(filepath.Join(dirPath, "hooks"))
-		os.Rename(filepath.Join(dirPath, "hooks.old"), filepath.Join(dirPath, "hooks"))
+		os.RemoveAll(hooks)
+		// nothing backed up if there was no hooks directory
+		if isExist {
+			os.Rename(filepath.Join(dirPath, "hooks.old"), hooks)
+		}
 		logger.Infoln(MESSAGES["Restore"])
 	}
 }
 
+// Install git-hooks into current git repo and its checked out submodules,
+// nested submodules included
+func installRecursive(installer func()) {
+	installer()
+
+	out, err := gitExec("submodule foreach --quiet --recursive pwd")
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+	if out == "" {
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+	defer os.Chdir(wd)
+
+	for _, dir := range strings.Split(out, "\n") {
+		logger.Infoln(escapeColor("Install into submodule " + dir))
+		if err := os.Chdir(dir); err != nil {
+			logger.Errorln(err)
+			return
+		}
+		installer()
+	}
+}
+
 // Uninstall git-hooks from current git repo
 func uninstall() {
+	if isHooksPathInstalled(false) {
+		uninstallHooksPath(false)
+		return
+	}
 	install(false)
 }
 
@@ -191,10 +498,10 @@ func installGlobal(home string) {
 		homeTemplate = filepath.Join(home, homeTemplate)
 	}
 
-	isExist, _ := exists(homeTemplate)
-	if !isExist {
-		os.MkdirAll(filepath.Join(homeTemplate, "hooks"), 0755)
-		installInto(homeTemplate, tplPreInstall)
+	// template installed before only gets shims of new triggers
+	if err := writeShims(filepath.Join(homeTemplate, "hooks"), tplPreInstall); err != nil {
+		logger.Errorln(err)
+		return
 	}
 
 	gitExec(GIT["SetTemplateDir"] + homeTemplate)
@@ -294,130 +601,361 @@ func run(cmds ...string) {
 	trigger := filepath.Base(cmds[0])
 	args := cmds[1:]
 
-	runDirHooks(hookDirs(), trigger, args...)
-	runConfigHooks(hookConfigs(), getContribDir(), trigger, args...)
+	// stdout of protocol trigger is read by git, messages go to stderr
+	if contains(PROTOCOL_TRIGGERS[:], trigger) {
+		logger.out = os.Stderr
+	}
+
+	// changes hidden by interrupted run must come back, even if stash is turned off
+	if err := recoverStash(); err != nil {
+		logger.Errorln(err)
+		return
+	}
+
+	// triggers like reference-transaction fire on every ref update,
+	// leave before any other work if there is nothing to run
+	dirs, configs := hookDirs(), hookConfigs()
+	if !hasHooks(trigger, dirs, configs) {
+		return
+	}
+
+	// hooks like pre-push and pre-receive read from stdin,
+	// buffer it once so every hook receives a full copy
+	// Stdin of other triggers may be a pipe never closed, like in CI, leave it alone
+	var input []byte
+	var err error
+	if contains(INPUT_TRIGGERS[:], trigger) {
+		input, err = readInput(os.Stdin)
+		if err != nil {
+			logger.Warnln("Fail to read stdin", err)
+		}
+	}
+
+	// project hooks come with the repo, they never run before user review them
+	// Project not involved in trigger is left alone, hashing it on every ref update is wasteful
+	if isProjectInvolved(trigger, dirs, configs) && !isProjectTrusted() {
+		logger.Warnln(MESSAGES["Untrusted"])
+		delete(dirs, "project")
+		delete(configs, "project")
+	}
+	// fail before any hook runs, hooks of broken config would be silently left out
+	for _, scope := range SCOPES {
+		if config, ok := configs[scope]; ok {
+			if _, err := listHooksInConfig(config); err != nil {
+				logger.Errorln(escapeColor(err.Error()))
+				return
+			}
+		}
+	}
+	r := newRunner(configs, trigger, input, args...)
+
+	// hide changes not going to be committed from hooks
+	var s *stash
+	if getStash(configs, trigger) {
+		s, err = stashChanges()
+		if err != nil {
+			if s != nil {
+				s.restore()
+			}
+			logger.Errorln("Fail to stash changes ", err)
+			return
+		}
+		// stop starting hooks once interrupted, changes are still hidden
+		if s != nil {
+			r.interrupt = s.interrupted
+		}
+	}
+
+	runLegacyHooks(r)
+	runDirHooks(r, dirs)
+	runConfigHooks(r, configs, getContribDir())
+	r.executePassThrough()
+
+	if s != nil {
+		if err := s.restore(); err != nil {
+			logger.Errorln(err)
+			return
+		}
+		if s.interrupted() {
+			logger.Errorsln(130, MESSAGES["Interrupted"])
+			return
+		}
+	}
+	r.finish()
+}
+
+// Whether any legacy, dir or config hook is set up for trigger
+func hasHooks(trigger string, dirs, configs map[string]string) bool {
+	for _, dir := range legacyHookDirs() {
+		if _, ok := listLegacyHooks(dir)[trigger]; ok {
+			return true
+		}
+	}
+	for _, scope := range SCOPES {
+		if hasScopeHooks(scope, trigger, dirs, configs) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether scope has dir or config hooks of trigger
+// Broken config counts, it must be reported instead of ignored
+func hasScopeHooks(scope, trigger string, dirs, configs map[string]string) bool {
+	if dir, ok := dirs[scope]; ok {
+		structure, err := listHooksInDir(scope, dir)
+		if err == nil && (len(structure[trigger]) != 0 || len(structure["_"+trigger]) != 0) {
+			return true
+		}
+	}
+	if config, ok := configs[scope]; ok {
+		structure, err := listHooksInConfig(config)
+		if err != nil {
+			return true
+		}
+		if options, ok := structure[trigger]; ok && options != nil && len(options.Repos) != 0 {
+			return true
+		}
+	}
+	return false
 }
 
-func runDirHooks(dirs map[string]string, current string, args ...string) {
-	for scope, dir := range dirs {
+// Whether project scope has hooks or options of trigger
+func isProjectInvolved(trigger string, dirs, configs map[string]string) bool {
+	if hasScopeHooks("project", trigger, dirs, configs) {
+		return true
+	}
+	if config, ok := configs["project"]; ok {
+		structure, _ := listHooksInConfig(config)
+		_, ok := structure[trigger]
+		return ok
+	}
+	return false
+}
+
+func runDirHooks(r *runner, dirs map[string]string) {
+	jobs := make([]*hookJob, 0)
+	for _, scope := range SCOPES {
+		dir, ok := dirs[scope]
+		if !ok {
+			continue
+		}
+
 		structure, err := listHooksInDir(scope, dir)
 		if err != nil {
 			continue
 		}
 
-		for trigger, hooks := range structure {
+		for _, trigger := range sortedTriggers(structure) {
 			// semi scope
-			if trigger != current && trigger != ("_"+current) {
+			if trigger != r.trigger && trigger != ("_"+r.trigger) {
 				continue
 			}
-			for _, hook := range hooks {
-				status, err := runHook(filepath.Join(dir, trigger, hook), args...)
-				if err != nil {
-					logger.Errorsln(status, err)
-					return
-				}
+			for _, hook := range structure[trigger] {
+				jobs = append(jobs, &hookJob{
+					scope:   scope,
+					id:      hook,
+					name:    filepath.Join(trigger, hook),
+					path:    filepath.Join(dir, trigger, hook),
+					timeout: r.timeout,
+				})
 			}
 		}
 	}
+	r.execute(jobs)
 }
 
-func runConfigHooks(configs map[string]string, contrib string, current string, args ...string) {
-	// wether contrib repo updated
-	updated := false
+func runConfigHooks(r *runner, configs map[string]string, contrib string) {
+	allowed := getAllowedSources()
+	jobs := make([]*hookJob, 0)
+	for _, scope := range SCOPES {
+		config, ok := configs[scope]
+		if !ok {
+			continue
+		}
 
-	for _, config := range configs {
 		structure, err := listHooksInConfig(config)
 		if err != nil {
-			continue
+			logger.Errorln(escapeColor(err.Error()))
+			return
 		}
 
-		for trigger, repo := range structure {
-			if trigger != current {
-				continue
+		if options, ok := structure[r.trigger]; ok {
+			locked, err := readLock(config)
+			if err != nil {
+				logger.Errorln(err)
+				return
 			}
 
-			for repoName, hooks := range repo {
-				fullGitAddress, strippedGitAddress := findProtocol(repoName)
-				// check if repo exist in local file system
-				isExist, _ := exists(filepath.Join(contrib, strippedGitAddress))
-				if !isExist {
-					cmd := fmt.Sprintf("clone %s %s", fullGitAddress, filepath.Join(contrib, strippedGitAddress))
-					logger.Infoln(cmd)
-					_, err := gitExec(cmd)
-					if err != nil {
-						logger.Warnln(err)
-						continue
-					}
+			for _, repo := range options.Repos {
+				// never clone or run repos from sources not allowed
+				if err := checkSource(repo, config, allowed); err != nil {
+					logger.Errorln(escapeColor(err.Error()))
+					return
 				}
 
-				for index := 0; index < len(hooks); index++ {
-					hook := hooks[index]
+				// locked repo run at its locked commit, or not at all
+				isLocked := locked != nil && !repo.isLocal()
+				checkout := repo
+				if isLocked {
+					pinned, ok := locked.pin(repo)
+					if !ok {
+						logger.Errorln(escapeColor(fmt.Sprintf("%s is not locked, run `git hooks lock` to lock it", repo)))
+						return
+					}
+					checkout = pinned
+				}
 
-					status, err := runHook(filepath.Join(contrib, strippedGitAddress, hook), args...)
-					if err == nil {
-						// skip update if everything ok
-						continue
+				dir, err := checkoutRepo(contrib, checkout, r.offline)
+				if err != nil {
+					if isLocked {
+						logger.Errorln(escapeColor(fmt.Sprintf("%s locked at %s can't be checked out: %s", repo, checkout.Rev, err)))
+						return
 					}
+					// skipping hooks silently is unsafe when network is not expected
+					if r.offline {
+						logger.Errorln(escapeColor(err.Error()))
+						return
+					}
+					logger.Warnln(escapeColor(err.Error()))
+					continue
+				}
+				if !repo.isLocal() {
+					markUsed(dir, config)
+				}
+
+				// wether contrib repo updated
+				updated := false
+				for _, hook := range repo.Hooks {
+					path := filepath.Join(dir, hook.Name)
 
 					// hook not found
-					if status == 126 && !updated {
+					isExist, _ := exists(path)
+					if !isExist && !updated && !r.offline && !repo.isLocal() && !isLocked {
 						// try to update contrib repo
 						logger.Infoln("Updating contrib hooks")
 						updated = true
 
-						_, err := gitExecWithDir(filepath.Join(contrib, strippedGitAddress), "pull origin master")
-						if err == nil {
-							// try again
-							index--
-							continue
+						if err := updateRepo(dir, repo.Rev); err != nil {
+							logger.Warnln("Something wrong with contrib hook")
 						}
+					}
 
-						logger.Warnln("Something wrong with contrib hook")
+					timeout := r.timeout
+					if hook.Timeout > 0 {
+						timeout = time.Duration(hook.Timeout)
+					}
+
+					jobs = append(jobs, &hookJob{
+						scope:   scope,
+						id:      hook.Name,
+						name:    filepath.Join(repo.Name, hook.Name),
+						path:    path,
+						timeout: timeout,
+						before:  hook.Before,
+						after:   hook.After,
+						include: hook.Files,
+						exclude: hook.Exclude,
+						fix:     hook.Fix,
+					})
+				}
+
+				if err := verifyRepo(repo, dir); err != nil {
+					logger.Errorln(escapeColor(err.Error()))
+					return
+				}
+
+				if isLocked {
+					if err := locked.verify(repo, dir); err != nil {
+						logger.Errorln(escapeColor(err.Error()))
+						return
 					}
-					logger.Errorsln(status, err)
 				}
 			}
 		}
 	}
+
+	jobs, err := sortJobs(jobs)
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+	r.execute(jobs)
 }
 
-// Execute specific hook with arguments
+// Execute prepared hook command
+// Hook is killed with its process group if not finished within timeout,
+// zero timeout means wait forever
 // Return error message as out if error occured
-func runHook(hook string, args ...string) (status int, err error) {
-	cmd := exec.Command(hook, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err = cmd.Run(); err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if waitStatus, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				return waitStatus.ExitStatus(), err
-			}
-		} else if _, ok := err.(*os.PathError); ok {
-			// Command can't be execute
-			// http://tldp.org/LDP/abs/html/exitcodes.html
-			return 126, err
-		} else {
-			// exit status unknown
-			status = 255
+func runHook(cmd *exec.Cmd, timeout time.Duration) (status int, err error) {
+	if timeout > 0 {
+		// run in its own process group, so processes spawned by hook are killed as well
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+
+	if err = cmd.Start(); err != nil {
+		return exitStatus(err), err
+	}
+
+	if timeout <= 0 {
+		err = cmd.Wait()
+		return exitStatus(err), err
+	}
+
+	// process group no longer receive signals from terminal, relay them
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	expired := time.After(timeout)
+	for {
+		select {
+		case err = <-done:
+			return exitStatus(err), err
+		case sig := <-signals:
+			syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+		case <-expired:
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+			// same exit status as timeout(1)
+			return 124, &timeoutError{hook: cmd.Path, timeout: timeout}
 		}
 	}
+}
 
-	return
+// Find exit status of finished command
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		if waitStatus, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			return waitStatus.ExitStatus()
+		}
+	} else if _, ok := err.(*os.PathError); ok {
+		// Command can't be execute
+		// http://tldp.org/LDP/abs/html/exitcodes.html
+		return 126
+	}
+
+	// exit status unknown
+	return 255
 }
 
-func installInto(dir string, template string) {
+func installInto(dir string, template string) error {
 	// backup
-	os.Rename(filepath.Join(dir, "hooks"), filepath.Join(dir, "hooks.old"))
-
-	os.Mkdir(filepath.Join(dir, "hooks"), 0755)
-	for _, hook := range TRIGGERS {
-		logger.Infoln("Install " + hook)
-		f, _ := os.Create(filepath.Join(dir, "hooks", hook))
-		f.WriteString(template)
-		f.Sync()
-		f.Chmod(0755)
+	err := os.Rename(filepath.Join(dir, "hooks"), filepath.Join(dir, "hooks.old"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
+
+	return writeShims(filepath.Join(dir, "hooks"), template)
 }
 
 func findProtocol(input string) (string, string) {
@@ -436,6 +974,38 @@ func findProtocol(input string) (string, string) {
 		noProtocol := protocol.ReplaceAllString(input, "$1")
 		return input, noProtocol
 	}
+	// check for file
+	protocol = regexp.MustCompile("^file://(.*)")
+	match = protocol.MatchString(input)
+	if match {
+		path := protocol.ReplaceAllString(input, "$1")
+		return input, strings.TrimLeft(path, "/")
+	}
+	// check for other url, like git://host/org/repo
+	protocol = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9+.-]*://(?:[^@/]+@)?(.*)")
+	match = protocol.MatchString(input)
+	if match {
+		noProtocolNoUser := protocol.ReplaceAllString(input, "$1")
+		return input, noProtocolNoUser
+	}
+	// local path, used as is
+	if isLocalPath(input) {
+		return input, input
+	}
+	// check for scp-like syntax, like git@github.com:org/repo
+	protocol = regexp.MustCompile("^(?:[a-zA-Z0-9_.-]+@)?([a-zA-Z0-9.-]+):/?(.*)")
+	match = protocol.MatchString(input)
+	if match {
+		noProtocolNoUser := protocol.ReplaceAllString(input, "$1/$2")
+		return input, noProtocolNoUser
+	}
 	// no protocol
 	return fmt.Sprintf("https://%s", input), input
 }
+
+// Whether contrib repo is an absolute path or a path relative to config file,
+// relative path must start with `./` or `../` to tell from bare host path
+func isLocalPath(input string) bool {
+	return filepath.IsAbs(input) || input == "." || input == ".." ||
+		strings.HasPrefix(input, "./") || strings.HasPrefix(input, "../")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +15,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Create temporary directory
@@ -92,13 +94,61 @@ func TestInstall(t *testing.T) {
 	// installed
 	createGitRepo(t, func(tempdir string) {
 		install(true)
-		assert.Equal(t, len(TRIGGERS)*2, len(logger.infos)) // with newline
+		assert.Equal(t, len(supportedTriggers())*2, len(logger.infos)) // with newline
 		logger.clear()
 	})
 
 	// already installed
 	createGitRepo(t, func(tempdir string) {
 		install(true)
+		logger.clear()
+
+		install(true)
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, MESSAGES["UpToDate"]+filepath.Join(".git", "hooks"), logger.infos[0])
+		logger.clear()
+
+		// trigger supported since last install
+		os.Remove(filepath.Join(".git", "hooks", "pre-push"))
+		install(true)
+		assert.Equal(t, []interface{}{"Install pre-push", "\n"}, logger.infos)
+		assert.True(t, isShim(filepath.Join(".git", "hooks", "pre-push"), tplPostInstall))
+		logger.clear()
+
+		// hook added by user is kept
+		createHook(t, ".git", "hooks", "pre-push", "exit 0")
+		install(true)
+		assert.Equal(t, MESSAGES["KeepHook"]+filepath.Join(".git", "hooks", "pre-push"), logger.warns[0])
+		assert.False(t, isShim(filepath.Join(".git", "hooks", "pre-push"), tplPostInstall))
+		logger.clear()
+	})
+
+	// repo created without hooks directory
+	createGitRepo(t, func(tempdir string) {
+		assert.Nil(t, os.RemoveAll(filepath.Join(".git", "hooks")))
+		install(true)
+		logger.clear()
+
+		install(true)
+		assert.Equal(t, 0, len(logger.errors))
+		isExist, _ := exists(filepath.Join(".git", "hooks.old"))
+		assert.False(t, isExist)
+		installed, _ := isInstalled()
+		assert.True(t, installed)
+		logger.clear()
+
+		uninstall()
+		assert.Equal(t, MESSAGES["Restore"], logger.infos[0])
+		installed, _ = isInstalled()
+		assert.False(t, installed)
+		isExist, _ = exists(filepath.Join(".git", "hooks"))
+		assert.False(t, isExist)
+		logger.clear()
+	})
+
+	// hooks.old not backed up by install
+	createGitRepo(t, func(tempdir string) {
+		os.Mkdir(filepath.Join(".git", "hooks.old"), 0755)
 		install(true)
 		assert.Equal(t, MESSAGES["ExistHooks"], logger.errors[0])
 		logger.clear()
@@ -148,7 +198,8 @@ func TestInstallGlobal(t *testing.T) {
 		newTemplatedir, err := gitExec(GIT["GetTemplateDir"])
 		assert.Nil(t, err)
 		assert.Equal(t, DIRS["HomeTemplate"], newTemplatedir)
-		assert.True(t, strings.HasPrefix(logger.infos[0].(string), MESSAGES["SetTemplateDir"]))
+		assert.Equal(t, MESSAGES["UpToDate"]+filepath.Join(DIRS["HomeTemplate"], "hooks"), logger.infos[0])
+		assert.True(t, strings.HasPrefix(logger.infos[len(logger.infos)-2].(string), MESSAGES["SetTemplateDir"]))
 		logger.clear()
 	})
 
@@ -279,7 +330,331 @@ func TestProtocol(t *testing.T) {
 	noProtocol, noProtocolNoUser = findProtocol(gitUrl)
 	assert.True(t, noProtocolNoUser == "my.git.repository.com/org/repo")
 	assert.True(t, noProtocol == "git@my.git.repository.com:org/repo")
+
+	for input, expected := range map[string][2]string{
+		"git@my.git.repository.com:org/repo":       {"git@my.git.repository.com:org/repo", "my.git.repository.com/org/repo"},
+		"my.git.repository.com:org/repo":           {"my.git.repository.com:org/repo", "my.git.repository.com/org/repo"},
+		"ssh://git@my.git.repository.com/org/repo": {"ssh://git@my.git.repository.com/org/repo", "my.git.repository.com/org/repo"},
+		"git://my.git.repository.com/org/repo":     {"git://my.git.repository.com/org/repo", "my.git.repository.com/org/repo"},
+		"file:///srv/git/org/repo":                 {"file:///srv/git/org/repo", "srv/git/org/repo"},
+		"/srv/git/org/repo":                        {"/srv/git/org/repo", "/srv/git/org/repo"},
+		"../org/repo":                              {"../org/repo", "../org/repo"},
+	} {
+		noProtocol, noProtocolNoUser = findProtocol(input)
+		assert.Equal(t, expected[0], noProtocol, input)
+		assert.Equal(t, expected[1], noProtocolNoUser, input)
+	}
+}
+
+// Create executable hook script under directory
+func createHook(t *testing.T, dir, trigger, name, content string) {
+	err := os.MkdirAll(filepath.Join(dir, trigger), 0755)
+	assert.Nil(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, trigger, name), []byte("#!/usr/bin/env bash\n"+content), 0755)
+	assert.Nil(t, err)
+}
+
+// Replace stdin with file contains content during context
+func withStdin(t *testing.T, content string, context func()) {
+	file, err := ioutil.TempFile(os.TempDir(), "git-hooks-stdin")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(content)
+	assert.Nil(t, err)
+	_, err = file.Seek(0, 0)
+	assert.Nil(t, err)
+
+	stdin := os.Stdin
+	os.Stdin = file
+	context()
+	os.Stdin = stdin
+	file.Close()
 }
 
 func TestRun(t *testing.T) {
+	// missing trigger
+	run()
+	assert.Equal(t, "Missing trigger", logger.warns[0])
+	logger.clear()
+}
+
+func TestRunPrePush(t *testing.T) {
+	refs := "refs/heads/master 67890 refs/heads/foreign 12345\n"
+
+	// every hook receives full copy of stdin
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-push", "first", `cat > first.out; echo "$@" >> first.out`)
+		createHook(t, "githooks", "pre-push", "second", `cat > second.out; echo "$@" >> second.out`)
+
+		withStdin(t, refs, func() {
+			runTrusted(t, ".git/hooks/pre-push", "origin", "git@example.com:org/repo")
+		})
+		assert.Equal(t, 0, len(logger.errors))
+
+		for _, name := range []string{"first.out", "second.out"} {
+			out, err := ioutil.ReadFile(name)
+			assert.Nil(t, err)
+			assert.Equal(t, refs+"origin git@example.com:org/repo\n", string(out))
+		}
+		logger.clear()
+	})
+
+	// hook reject push according to stdin
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-push", "protect", `! grep -q refs/heads/master`)
+
+		withStdin(t, refs, func() {
+			runTrusted(t, "pre-push", "origin", "git@example.com:org/repo")
+		})
+		assert.True(t, len(logger.errors) != 0)
+		logger.clear()
+
+		withStdin(t, "refs/heads/feature 67890 refs/heads/feature 12345\n", func() {
+			runTrusted(t, "pre-push", "origin", "git@example.com:org/repo")
+		})
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+	})
+}
+
+// Stdin left open by script or CI never block triggers without input
+func TestRunOpenStdin(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "cat", `cat > cat.out`)
+
+		reader, writer, err := os.Pipe()
+		assert.Nil(t, err)
+		defer reader.Close()
+		defer writer.Close()
+		_, err = writer.WriteString("never closed\n")
+		assert.Nil(t, err)
+
+		stdin := os.Stdin
+		os.Stdin = reader
+		defer func() { os.Stdin = stdin }()
+
+		done := make(chan bool)
+		go func() {
+			runTrusted(t, "pre-commit")
+			done <- true
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("run blocked on open stdin")
+		}
+		assert.Equal(t, 0, len(logger.errors))
+
+		// hook doesn't see stdin of git-hooks
+		out, err := ioutil.ReadFile("cat.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "", string(out))
+		logger.clear()
+	})
+}
+
+func TestRunWithoutHooks(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "lint", `echo lint >> run.out`)
+
+		// leave before reading stdin git keeps open until hook exits
+		reader, writer, err := os.Pipe()
+		assert.Nil(t, err)
+		defer reader.Close()
+		defer writer.Close()
+		stdin := os.Stdin
+		os.Stdin = reader
+		defer func() { os.Stdin = stdin }()
+
+		done := make(chan bool)
+		go func() {
+			runTrusted(t, "reference-transaction", "prepared")
+			done <- true
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("run without hooks read stdin")
+		}
+		assert.Equal(t, 0, len(logger.infos))
+		assert.Equal(t, 0, len(logger.warns))
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+
+		// semi scope hook of trigger
+		createHook(t, "githooks", "_reference-transaction", "audit", `cat > audit.out`)
+		writer.WriteString("ref\n")
+		writer.Close()
+		runTrusted(t, "reference-transaction", "prepared")
+		out, err := ioutil.ReadFile("audit.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "ref\n", string(out))
+		logger.clear()
+	})
+}
+
+func TestRunProcReceive(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		// reply before stdin is closed, like pkt-line negotiation with git
+		createHook(t, "githooks", "proc-receive", "agit", `read line; echo "pong $line"; cat > rest.out`)
+
+		stdinReader, stdinWriter, err := os.Pipe()
+		assert.Nil(t, err)
+		defer stdinReader.Close()
+		defer stdinWriter.Close()
+		stdoutReader, stdoutWriter, err := os.Pipe()
+		assert.Nil(t, err)
+		defer stdoutReader.Close()
+		defer stdoutWriter.Close()
+
+		stdin, stdout := os.Stdin, os.Stdout
+		os.Stdin, os.Stdout = stdinReader, stdoutWriter
+		defer func() {
+			os.Stdin, os.Stdout = stdin, stdout
+			logger.out = nil
+		}()
+
+		done := make(chan bool)
+		go func() {
+			runTrusted(t, "proc-receive")
+			done <- true
+		}()
+
+		_, err = stdinWriter.WriteString("ping\n")
+		assert.Nil(t, err)
+		replies := make(chan string)
+		go func() {
+			line, _ := bufio.NewReader(stdoutReader).ReadString('\n')
+			replies <- line
+		}()
+		select {
+		case reply := <-replies:
+			assert.Equal(t, "pong ping\n", reply)
+		case <-time.After(5 * time.Second):
+			t.Fatal("hook got no stdin before it was closed")
+		}
+
+		_, err = stdinWriter.WriteString("flush\n")
+		assert.Nil(t, err)
+		stdinWriter.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("run blocked after stdin closed")
+		}
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, os.Stderr, logger.out)
+		out, err := ioutil.ReadFile("rest.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "flush\n", string(out))
+		logger.clear()
+
+		// replies of several hooks can't be combined
+		createHook(t, "githooks", "proc-receive", "other", `echo other >> run.out`)
+		runTrusted(t, "proc-receive")
+		assert.True(t, strings.Contains(logger.errors[0].(string), "only one hook can run for it: proc-receive/agit, proc-receive/other"))
+		isExist, _ := exists("run.out")
+		assert.False(t, isExist)
+		logger.clear()
+	})
+}
+
+func TestRunFsmonitorWatchman(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "fsmonitor-watchman", "watchman", `echo "$1 $2"; echo changed`)
+		err := exec.Command("git", "config", "hooks.cache", "true").Run()
+		assert.Nil(t, err)
+
+		reader, writer, err := os.Pipe()
+		assert.Nil(t, err)
+		defer reader.Close()
+		stdout := os.Stdout
+		os.Stdout = writer
+		defer func() {
+			os.Stdout = stdout
+			logger.out = nil
+		}()
+
+		// reply change every time, never cached
+		runTrusted(t, "fsmonitor-watchman", "2", "token")
+		runTrusted(t, "fsmonitor-watchman", "2", "token")
+		writer.Close()
+		out, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, "2 token\nchanged\n2 token\nchanged\n", string(out))
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+
+		// output of several hooks would corrupt reply
+		createHook(t, "githooks", "fsmonitor-watchman", "other", `echo other`)
+		runTrusted(t, "fsmonitor-watchman", "2", "token")
+		assert.True(t, strings.Contains(logger.errors[0].(string), "only one hook can run for it"))
+		logger.clear()
+	})
+}
+
+func TestDisable(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", `echo first >> run.out`)
+		createHook(t, "githooks", "pre-commit", "second", `echo second >> run.out`)
+
+		// invalid hook
+		disable("first")
+		assert.Equal(t, MESSAGES["InvalidHook"], logger.errors[0])
+		logger.clear()
+
+		disable("pre-commit/first")
+		assert.Equal(t, MESSAGES["Disabled"]+"pre-commit/first", logger.infos[0])
+		assert.Equal(t, []string{"pre-commit/first"}, getDisabledHooks())
+		logger.clear()
+
+		// disable twice
+		disable("pre-commit/first")
+		assert.Equal(t, []string{"pre-commit/first"}, getDisabledHooks())
+		logger.clear()
+
+		list()
+		assert.Contains(t, logger.infos, "    - first (disabled)")
+		assert.Contains(t, logger.infos, "    - second")
+		logger.clear()
+
+		runTrusted(t, "pre-commit")
+		out, err := ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "second\n", string(out))
+		assert.Contains(t, logger.infos, "Skip pre-commit/first, disabled")
+		logger.clear()
+
+		enable("pre-commit/first")
+		assert.Equal(t, MESSAGES["Enabled"]+"pre-commit/first", logger.infos[0])
+		assert.Equal(t, 0, len(getDisabledHooks()))
+		logger.clear()
+
+		os.Remove("run.out")
+		runTrusted(t, "pre-commit")
+		out, err = ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "first\nsecond\n", string(out))
+		logger.clear()
+	})
+}
+
+func TestSkipEnv(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", `echo first >> run.out`)
+		createHook(t, "githooks", "pre-commit", "second", `echo second >> run.out`)
+		createHook(t, "githooks", "pre-commit", "third", `echo third >> run.out`)
+
+		os.Setenv(ENV_SKIP, "first, pre-commit/third")
+		runTrusted(t, "pre-commit")
+		os.Unsetenv(ENV_SKIP)
+
+		out, err := ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "second\n", string(out))
+		assert.Contains(t, logger.infos, "Skip pre-commit/first, skipped by SKIP")
+		logger.clear()
+	})
 }
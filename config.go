@@ -6,10 +6,51 @@ import (
 
 var VERSION = "v1.3.1"
 var NAME = "git-hooks"
-var TRIGGERS = [...]string{"applypatch-msg", "commit-msg", "post-applypatch", "post-checkout", "post-commit", "post-merge", "post-receive", "pre-applypatch", "pre-auto-gc", "pre-commit", "prepare-commit-msg", "pre-rebase", "pre-receive", "update", "pre-push"}
+var TRIGGERS = [...]string{"applypatch-msg", "commit-msg", "post-applypatch", "post-checkout", "post-commit", "post-merge", "post-receive", "pre-applypatch", "pre-auto-gc", "pre-commit", "prepare-commit-msg", "pre-rebase", "pre-receive", "update", "pre-push", "post-update", "post-rewrite", "pre-merge-commit", "push-to-checkout", "reference-transaction", "post-index-change", "sendemail-validate", "proc-receive", "fsmonitor-watchman", "p4-pre-submit", "p4-prepare-changelist", "p4-changelist", "p4-post-changelist"}
+
+// Triggers git feed input to through stdin, stdin of other triggers is never read
+var INPUT_TRIGGERS = [...]string{"pre-push", "pre-receive", "post-receive", "post-rewrite", "reference-transaction"}
+
+// Triggers run before index is committed, hooks of other triggers get no staged files
+var STAGED_TRIGGERS = [...]string{"pre-commit", "pre-merge-commit"}
+
+// Triggers talking to git by a protocol over stdin and stdout,
+// only a single hook may run for them with stdin and stdout of git
+var PROTOCOL_TRIGGERS = [...]string{"proc-receive", "fsmonitor-watchman"}
+
+// Git version introducing trigger, triggers not listed are supported by any git in use
+var TRIGGER_VERSIONS = map[string]string{
+	"pre-push":              "1.8.2",
+	"push-to-checkout":      "2.4.0",
+	"fsmonitor-watchman":    "2.16.0",
+	"p4-pre-submit":         "2.17.0",
+	"post-index-change":     "2.22.0",
+	"pre-merge-commit":      "2.24.0",
+	"reference-transaction": "2.28.0",
+	"p4-prepare-changelist": "2.28.0",
+	"p4-changelist":         "2.28.0",
+	"p4-post-changelist":    "2.28.0",
+	"proc-receive":          "2.29.0",
+}
+
+// Hooks run scope by scope in this order
+var SCOPES = [...]string{"global", "user", "project"}
 
 var CONTRIB_DIRNAME = "githooks-contrib"
 
+// File under git dir of contrib repo recording configs using it,
+// modified every time the repo is used
+var CONTRIB_USED_FILENAME = "git-hooks-used"
+
+// Directory under git dir keeping shims pointed by local core.hooksPath
+var HOOKS_PATH_DIRNAME = "git-hooks-path"
+
+// Directory under git dir keeping changes stashed around pre-commit hooks
+var STASH_DIRNAME = "git-hooks-stash"
+
+// Directory under git dir keeping successful hook results
+var CACHE_DIRNAME = "git-hooks-cache"
+
 var tplPreInstall = `#!/usr/bin/env bash
 echo \"git hooks not installed in this repository.  Run 'git hooks --install' to install it or 'git hooks -h' for more information.\"`
 var tplPostInstall = `#!/usr/bin/env bash
@@ -17,9 +58,24 @@ git-hooks run "$0" "$@"`
 
 var ENV = os.Getenv("ENV")
 
+// Environment variables passed to hooks
+// Newline separated staged files, omitted if too large
+var ENV_STAGED_FILES = "GIT_HOOKS_STAGED_FILES"
+
+// Path to NUL separated staged files
+var ENV_STAGED_FILE_LIST = "GIT_HOOKS_STAGED_FILE_LIST"
+
+// Stash directory of running git-hooks, so git-hooks run by its hooks leave it alone
+var ENV_STASH = "GIT_HOOKS_STASH"
+
+// Comma separated hooks to skip, like `SKIP=golint,whitespace git commit`
+var ENV_SKIP = "SKIP"
+
 var DIRS = map[string]string{
 	"HomeTemplate":   ".git-template-with-git-hooks",
 	"GlobalTemplate": "/usr/share/git-core/templates",
+	// shims pointed by global core.hooksPath
+	"HomeHooksPath": ".git-hooks-path",
 }
 
 var GIT = map[string]string{
@@ -28,18 +84,46 @@ var GIT = map[string]string{
 	"UnsetTemplateDir":  "config --global --unset init.templatedir",
 	"RemoveTemplateDir": "config --global --remove init",
 	"FirstCommit":       "rev-list --max-parents=0 HEAD",
+	"DisabledHooks":     "config --get-all hooks.disabled",
+	"DisableHook":       "config --local --add hooks.disabled ",
+	"EnableHook":        "config --local --unset-all hooks.disabled ",
+	"StagedFiles":       "diff --cached --name-only -z --diff-filter=ACMR",
+	"TrustedHooks":      "config --local --get hooks.trusted",
+	"TrustHooks":        "config --local hooks.trusted ",
 }
 
 var MESSAGES = map[string]string{
-	"NotGitRepo":     "Current directory is not a git repo",
-	"Installed":      "Git hooks ARE installed in this repository.",
-	"NotInstalled":   "Git hooks are NOT installed in this repository. (Run 'git hooks install' to install it)",
-	"ExistHooks":     "hooks.old already exists, perhaps you already installed?",
-	"NotExistHooks":  "Error, hooks.old doesn't exists, aborting uninstall to not destroy something",
-	"Restore":        "Restore hooks.old",
-	"SetTemplateDir": "Git global config init.templatedir is now set to ",
-	"UpdateToDate":   "git-hooks is update to date",
-	"Incompatible":   "Version backward incompatible, manually update required",
+	"NotGitRepo":        "Current directory is not a git repo",
+	"Installed":         "Git hooks ARE installed in this repository.",
+	"NotInstalled":      "Git hooks are NOT installed in this repository. (Run 'git hooks install' to install it)",
+	"ExistHooks":        "hooks.old already exists, perhaps you already installed?",
+	"NotExistHooks":     "Error, hooks.old doesn't exists, aborting uninstall to not destroy something",
+	"Restore":           "Restore hooks.old",
+	"SetTemplateDir":    "Git global config init.templatedir is now set to ",
+	"UpdateToDate":      "git-hooks is update to date",
+	"Incompatible":      "Version backward incompatible, manually update required",
+	"RecoverStash":      "Restore changes stashed by an interrupted run",
+	"StashConflict":     "Hooks modified files with unstaged changes, discard modifications of hooks",
+	"StashKept":         "Fail to restore unstaged changes, they are kept in ",
+	"Interrupted":       "Interrupted",
+	"CacheCleared":      "Cached hook results cleared",
+	"InvalidHook":       "Hook should be specified as <trigger>/<hook>, like pre-commit/golint",
+	"Disabled":          "Disabled ",
+	"Enabled":           "Enabled ",
+	"NoProjectConfig":   "githooks.json not found in this repo",
+	"Offline":           "Network access refused in offline mode, unset hooks.offline to go online",
+	"ExistHooksPath":    "core.hooksPath is already set by other tool, aborting install to not override it: ",
+	"NotExistHooksPath": "core.hooksPath is not set by git-hooks, aborting uninstall",
+	"SetHooksPath":      "Git config core.hooksPath is now set to ",
+	"UnsetHooksPath":    "Unset core.hooksPath",
+	"HooksPath":         "Hooks are run from core.hooksPath ",
+	"HooksPathIgnored":  "Hooks are run from core.hooksPath instead, hooks installed in hooks directory are ignored by git: ",
+	"Untrusted":         "Project hooks are skipped until trusted, review githooks and githooks.json then run 'git hooks trust'",
+	"Trusted":           "Project hooks trusted, they run until they change",
+	"NoProjectHooks":    "No project hooks to trust",
+	"Locked":            "Contrib repos locked in ",
+	"UpToDate":          "Git hooks are up to date in ",
+	"KeepHook":          "Keep hook not installed by git-hooks: ",
 }
 
 func isTestEnv() bool {
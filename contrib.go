@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// Whether contrib repo is a local path, it's never cloned, updated or locked
+func (repo repoConfig) isLocal() bool {
+	return isLocalPath(repo.Name)
+}
+
+// Directory of contrib repo under contrib dir
+// Pinned revisions are checked out separately,
+// so projects pinning different revisions don't step on each other
+// Local repo is used in place
+func (repo repoConfig) dir(contrib string) string {
+	if repo.isLocal() {
+		if filepath.IsAbs(repo.Name) {
+			return repo.Name
+		}
+		return filepath.Join(repo.base, repo.Name)
+	}
+
+	_, strippedGitAddress := findProtocol(repo.Name)
+	if repo.Rev == "" {
+		return filepath.Join(contrib, strippedGitAddress)
+	}
+	return filepath.Join(contrib, strippedGitAddress+"@"+url.PathEscape(repo.Rev))
+}
+
+// Address of repo matched against allowed sources, without protocol and user,
+// like github.com/org/hooks, or absolute path of local repo
+func (repo repoConfig) source() string {
+	if repo.isLocal() {
+		return repo.dir("")
+	}
+	_, strippedGitAddress := findProtocol(repo.Name)
+	return strippedGitAddress
+}
+
+// Glob patterns of allowed contrib sources by system or global git config hooks.allowedSources,
+// like github.com/our-org/*, nil if every source is allowed
+// Repo config is ignored, so a repo can't allow sources by itself
+func getAllowedSources() []string {
+	var allowed []string
+	for _, scope := range []string{"--system", "--global"} {
+		out, err := gitExec("config " + scope + " --get-all hooks.allowedSources")
+		if err == nil && out != "" {
+			allowed = append(allowed, strings.Split(out, "\n")...)
+		}
+	}
+	return allowed
+}
+
+// Refuse repo referenced by config if its source is not allowed
+func checkSource(repo repoConfig, config string, allowed []string) error {
+	if allowed == nil || matchAny(allowed, repo.source()) {
+		return nil
+	}
+	return fmt.Errorf("%s referenced by %s is not allowed by hooks.allowedSources", repo, config)
+}
+
+// Whether network access is refused by git config hooks.offline
+func getOffline() bool {
+	value, err := gitExec("config --bool --get hooks.offline")
+	return err == nil && value == "true"
+}
+
+// Clone contrib repo if missing and check out its pinned revision
+// Nothing is cloned or fetched in offline mode
+// Return directory of the checkout
+func checkoutRepo(contrib string, repo repoConfig, offline bool) (string, error) {
+	dir := repo.dir(contrib)
+
+	if repo.isLocal() {
+		if repo.Rev != "" {
+			return "", fmt.Errorf("%s: revision can't be pinned for local path", repo)
+		}
+		// check if repo exist in local file system
+		isExist, _ := exists(dir)
+		if !isExist {
+			return "", fmt.Errorf("%s not found", dir)
+		}
+		return dir, nil
+	}
+
+	return dir, withRepoLock(dir, func() error {
+		return cloneRepo(dir, repo, offline)
+	})
+}
+
+// Clone contrib repo into directory if missing and check out its pinned revision
+// Repo is cloned into a temporary directory then moved into place,
+// so a directory exists only if clone succeed
+// Caller must hold lock of the repo
+func cloneRepo(dir string, repo repoConfig, offline bool) error {
+	// check if repo exist in local file system
+	isExist, _ := exists(dir)
+	if isExist {
+		if repo.Rev == "" {
+			return nil
+		}
+		return checkoutRev(dir, repo.Rev, offline)
+	}
+
+	if offline {
+		return fmt.Errorf("%s not found at %s, run `git hooks fetch` before going offline", repo, dir)
+	}
+
+	temp, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+".")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+
+	fullGitAddress, _ := findProtocol(repo.Name)
+	logger.Infoln(escapeColor(fmt.Sprintf("clone %s %s", fullGitAddress, dir)))
+	if _, err := gitExecRaw("", nil, "clone", "--quiet", fullGitAddress, temp); err != nil {
+		return err
+	}
+	if repo.Rev != "" {
+		if err := checkoutRev(temp, repo.Rev, offline); err != nil {
+			return err
+		}
+	}
+	return os.Rename(temp, dir)
+}
+
+// Run fn holding exclusive lock of contrib repo,
+// so concurrent git-hooks processes never clone, fetch or check out the same repo
+// Lock file lives next to the repo, it can be taken before the repo is cloned
+func withRepoLock(dir string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+
+	path := dir + ".lock"
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			if err != syscall.EWOULDBLOCK {
+				file.Close()
+				return err
+			}
+			logger.Infoln(escapeColor("Waiting for another git-hooks using " + dir))
+			if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+				file.Close()
+				return err
+			}
+		}
+
+		// lock file removed by prune while waiting, lock the new one
+		locked, err := file.Stat()
+		current, statErr := os.Stat(path)
+		if err != nil || statErr != nil || !os.SameFile(locked, current) {
+			file.Close()
+			continue
+		}
+
+		// lock is released on close
+		defer file.Close()
+		return fn()
+	}
+}
+
+// Update contrib repo checkout
+// Unpinned repo follows its default branch, pinned repo is checked out again
+// after fetch, which moves branch pins to the latest commit
+func updateRepo(dir, rev string) error {
+	return withRepoLock(dir, func() error {
+		if rev == "" {
+			_, err := gitExecRaw(dir, nil, "pull", "--quiet", "--ff-only")
+			return err
+		}
+
+		if _, err := gitExecRaw(dir, nil, "fetch", "--quiet", "--tags", "origin"); err != nil {
+			return err
+		}
+		return checkoutRev(dir, rev, false)
+	})
+}
+
+// Detach HEAD of contrib repo at revision, fetch if revision is unknown
+func checkoutRev(dir, rev string, offline bool) error {
+	commit, err := resolveRev(dir, rev)
+	if err != nil {
+		if offline {
+			return err
+		}
+		if _, err := gitExecRaw(dir, nil, "fetch", "--quiet", "--tags", "origin"); err != nil {
+			return err
+		}
+		if commit, err = resolveRev(dir, rev); err != nil {
+			return err
+		}
+	}
+
+	head, _ := gitExecWithDir(dir, "rev-parse HEAD")
+	if head == commit {
+		return nil
+	}
+	_, err = gitExecRaw(dir, nil, "checkout", "--quiet", "--detach", commit)
+	return err
+}
+
+// Find commit of revision in contrib repo
+// Branches are resolved from remote, local ones may be outdated
+func resolveRev(dir, rev string) (string, error) {
+	for _, name := range []string{"refs/remotes/origin/" + rev, rev} {
+		out, err := gitExecRaw(dir, nil, "rev-parse", "--verify", "--quiet", name+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	return "", fmt.Errorf("revision %s not found in %s", rev, dir)
+}
+
+// Pin contrib repos of project config to their newest tags
+// Print commits between old and new revision of each repo
+func autoupdate() {
+	if getOffline() {
+		logger.Errorln(MESSAGES["Offline"])
+		return
+	}
+
+	config, ok := hookConfigs()["project"]
+	if !ok {
+		logger.Errorln(MESSAGES["NoProjectConfig"])
+		return
+	}
+
+	content, err := ioutil.ReadFile(config)
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+
+	structure, err := listHooksInConfig(config)
+	if err != nil {
+		logger.Errorln(escapeColor(err.Error()))
+		return
+	}
+
+	contrib := getContribDir()
+	allowed := getAllowedSources()
+	// newest revision of repos
+	revs := make(map[string]string)
+	for _, trigger := range sortedTriggers(structure) {
+		for _, repo := range structure[trigger].Repos {
+			if repo.isLocal() {
+				continue
+			}
+
+			if err := checkSource(repo, config, allowed); err != nil {
+				logger.Errorln(escapeColor(err.Error()))
+				return
+			}
+
+			rev, ok := revs[repo.String()]
+			if !ok {
+				if rev, err = updateRev(contrib, repo); err != nil {
+					logger.Errorln(escapeColor(fmt.Sprintf("%s: %s", repo, err)))
+					return
+				}
+				markUsed(repo.dir(contrib), config)
+				revs[repo.String()] = rev
+			}
+
+			if rev == repo.Rev {
+				continue
+			}
+			if content, err = pinRev(content, repo, rev); err != nil {
+				logger.Errorln(escapeColor(err.Error()))
+				return
+			}
+		}
+	}
+
+	if err := ioutil.WriteFile(config, content, 0644); err != nil {
+		logger.Errorln(err)
+		return
+	}
+
+	// keep lock file in sync with new revisions
+	isExist, _ := exists(getLockPath(config))
+	if isExist {
+		lock()
+	}
+}
+
+// Find newest tag of contrib repo and print changes since current revision
+func updateRev(contrib string, repo repoConfig) (string, error) {
+	dir, err := checkoutRepo(contrib, repo, false)
+	if err != nil {
+		return "", err
+	}
+	err = withRepoLock(dir, func() error {
+		_, err := gitExecRaw(dir, nil, "fetch", "--quiet", "--tags", "origin")
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	rev, err := latestRev(dir)
+	if err != nil {
+		return "", err
+	}
+
+	old, err := gitExecWithDir(dir, "rev-parse HEAD")
+	if err != nil {
+		return "", err
+	}
+	commit, err := resolveRev(dir, rev)
+	if err != nil {
+		return "", err
+	}
+	if old == commit {
+		logger.Infoln(escapeColor(fmt.Sprintf("%s is up to date at %s (%s)", repo, rev, commit)))
+		return rev, nil
+	}
+
+	logger.Infoln(escapeColor(fmt.Sprintf("Update %s to %s", repo, rev)))
+	logger.Infoln(fmt.Sprintf("  %s..%s", old, commit))
+	changes, _ := gitExecRaw(dir, nil, "log", "--oneline", "--no-decorate", old+".."+commit)
+	for _, change := range strings.Split(strings.TrimSpace(string(changes)), "\n") {
+		if change != "" {
+			logger.Infoln(escapeColor("  " + change))
+		}
+	}
+	return rev, nil
+}
+
+// Newest tag on default branch of contrib repo, latest commit if not tagged
+func latestRev(dir string) (string, error) {
+	out, err := gitExecRaw(dir, nil, "describe", "--tags", "--abbrev=0", "refs/remotes/origin/HEAD")
+	if err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+	return resolveRev(dir, "refs/remotes/origin/HEAD")
+}
+
+// Rewrite revision of repo in config content, formatting of config is kept
+// Revision is replaced in place if pinned by `rev` field, appended to key otherwise
+func pinRev(content []byte, repo repoConfig, rev string) ([]byte, error) {
+	key, value := repo.key, repo.value
+	field := regexp.MustCompile(`("rev"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	if bytes.HasPrefix(value, []byte("{")) && field.Match(value) {
+		quoted, _ := json.Marshal(rev)
+		value = field.ReplaceAllFunc(repo.value, func(match []byte) []byte {
+			return append(append([]byte{}, field.FindSubmatch(match)[1]...), quoted...)
+		})
+	} else {
+		pinned := parseRepo(parseRepo(key).Name + "@" + rev)
+		if pinned.Rev != rev {
+			return nil, fmt.Errorf("%s: can't pin %s in key, use object form with `rev` field", repo.Name, rev)
+		}
+		key = pinned.String()
+	}
+
+	oldKey, _ := json.Marshal(repo.key)
+	newKey, _ := json.Marshal(key)
+	member := regexp.MustCompile(regexp.QuoteMeta(string(oldKey)) + `(\s*:\s*)` + regexp.QuoteMeta(string(repo.value)))
+	return member.ReplaceAllFunc(content, func(match []byte) []byte {
+		separator := member.FindSubmatch(match)[1]
+		return append(append(append([]byte{}, newKey...), separator...), value...)
+	}), nil
+}
+
+// Clone missing contrib repos of current configs and fetch their latest commits,
+// so hooks can run offline
+func fetch() {
+	if getOffline() {
+		logger.Errorln(MESSAGES["Offline"])
+		return
+	}
+
+	contrib := getContribDir()
+	allowed := getAllowedSources()
+	fetched := make(map[string]bool)
+	configs := hookConfigs()
+	for _, scope := range SCOPES {
+		config, ok := configs[scope]
+		if !ok {
+			continue
+		}
+
+		structure, err := listHooksInConfig(config)
+		if err != nil {
+			logger.Errorln(escapeColor(err.Error()))
+			return
+		}
+		locked, err := readLock(config)
+		if err != nil {
+			logger.Errorln(err)
+			return
+		}
+
+		for _, trigger := range sortedTriggers(structure) {
+			for _, repo := range structure[trigger].Repos {
+				if repo.isLocal() {
+					continue
+				}
+				// locked repo run at its locked commit
+				if pinned, ok := locked.pin(repo); ok {
+					repo = pinned
+				}
+				if fetched[repo.dir(contrib)] {
+					continue
+				}
+				fetched[repo.dir(contrib)] = true
+
+				if err := checkSource(repo, config, allowed); err != nil {
+					logger.Errorln(escapeColor(err.Error()))
+					return
+				}
+				if err := fetchRepo(contrib, repo); err != nil {
+					logger.Errorln(escapeColor(fmt.Sprintf("%s: %s", repo, err)))
+					return
+				}
+				// fetched for offline use, prune must keep it
+				markUsed(repo.dir(contrib), config)
+				logger.Infoln(escapeColor("Fetched " + repo.String()))
+			}
+		}
+	}
+}
+
+// Clone contrib repo if missing, fetch and check out pinned revision otherwise
+// Unpinned repo is fetched without moving its checkout
+func fetchRepo(contrib string, repo repoConfig) error {
+	dir := repo.dir(contrib)
+	return withRepoLock(dir, func() error {
+		isExist, _ := exists(dir)
+		if isExist {
+			if _, err := gitExecRaw(dir, nil, "fetch", "--quiet", "--tags", "origin"); err != nil {
+				return err
+			}
+		}
+		return cloneRepo(dir, repo, false)
+	})
+}
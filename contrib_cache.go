@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Record config file using contrib repo, mark repo as used now
+func markUsed(dir, config string) error {
+	users := getUsers(dir)
+	for _, user := range users {
+		if user == config {
+			now := time.Now()
+			return os.Chtimes(getUsedPath(dir), now, now)
+		}
+	}
+
+	users = append(users, config)
+	return ioutil.WriteFile(getUsedPath(dir), []byte(strings.Join(users, "\n")+"\n"), 0644)
+}
+
+func getUsedPath(dir string) string {
+	return filepath.Join(dir, ".git", CONTRIB_USED_FILENAME)
+}
+
+// Config files ever used contrib repo
+func getUsers(dir string) []string {
+	users := make([]string, 0)
+	content, err := ioutil.ReadFile(getUsedPath(dir))
+	if err != nil {
+		return users
+	}
+	for _, user := range strings.Split(string(content), "\n") {
+		if user != "" {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// Last time contrib repo used, zero if never used
+func getLastUsed(dir string) time.Time {
+	info, err := os.Stat(getUsedPath(dir))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// List repos cloned under contrib dir
+func listContribRepos(contrib string) ([]string, error) {
+	dirs := make([]string, 0)
+	err := filepath.Walk(contrib, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		// repo being cloned
+		if path != contrib && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		isExist, _ := exists(filepath.Join(path, ".git"))
+		if isExist {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return dirs, nil
+	}
+	return dirs, err
+}
+
+// Whether any of config files reference contrib repo
+func isReferenced(contrib, dir string, configs []string) bool {
+	for _, config := range configs {
+		structure, err := listHooksInConfig(config)
+		if os.IsNotExist(err) {
+			continue
+		}
+		locked, lockErr := readLock(config)
+		// keep repos of config broken for now
+		if err != nil || lockErr != nil {
+			return true
+		}
+
+		for _, options := range structure {
+			if options == nil {
+				continue
+			}
+			for _, repo := range options.Repos {
+				if repo.isLocal() {
+					continue
+				}
+				if repo.dir(contrib) == dir {
+					return true
+				}
+				if pinned, ok := locked.pin(repo); ok && pinned.dir(contrib) == dir {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Show repos cloned under contrib dir
+func listContrib() {
+	contrib := getContribDir()
+	dirs, err := listContribRepos(contrib)
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+	if len(dirs) == 0 {
+		logger.Infoln("No contrib repo under " + contrib)
+		return
+	}
+
+	var table bytes.Buffer
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "REPO\tSIZE\tREVISION\tLAST USED")
+	for _, dir := range dirs {
+		name, _ := filepath.Rel(contrib, dir)
+		rev, err := gitExecWithDir(dir, "describe --tags --always")
+		if err != nil {
+			rev = "unknown"
+		}
+
+		used := "never"
+		if last := getLastUsed(dir); !last.IsZero() {
+			used = last.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", name, formatSize(dirSize(dir)), rev, used)
+	}
+	writer.Flush()
+	logger.Info(escapeColor(table.String()))
+}
+
+// Remove contrib repos no known config reference,
+// or not used within age given as argument or by git config hooks.pruneage
+// Known configs are configs of current repo and configs ever used the repo
+func pruneContrib(args ...string) {
+	value := ""
+	if len(args) != 0 {
+		value = args[0]
+	} else {
+		value, _ = gitExec("config --get hooks.pruneage")
+	}
+
+	var age duration
+	if value != "" {
+		var err error
+		if age, err = parseDuration(value); err != nil {
+			logger.Errorln(err)
+			return
+		}
+	}
+
+	contrib := getContribDir()
+	dirs, err := listContribRepos(contrib)
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+
+	configs := make([]string, 0)
+	for _, config := range hookConfigs() {
+		configs = append(configs, config)
+	}
+
+	for _, dir := range dirs {
+		reason := ""
+		last := getLastUsed(dir)
+		if !isReferenced(contrib, dir, append(getUsers(dir), configs...)) {
+			reason = "not referenced by any config"
+		} else if age > 0 && time.Since(last) > time.Duration(age) {
+			reason = "not used within " + time.Duration(age).String()
+		}
+		if reason == "" {
+			continue
+		}
+
+		err := withRepoLock(dir, func() error {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+			return os.Remove(dir + ".lock")
+		})
+		if err != nil {
+			logger.Errorln(err)
+			return
+		}
+		removeEmptyParents(contrib, dir)
+
+		name, _ := filepath.Rel(contrib, dir)
+		logger.Infoln(escapeColor(fmt.Sprintf("Remove %s, %s", name, reason)))
+	}
+}
+
+// Remove empty directories left by removed repo, up to root
+func removeEmptyParents(root, dir string) {
+	for parent := filepath.Dir(dir); parent != root && strings.HasPrefix(parent, root); parent = filepath.Dir(parent) {
+		// fail on non-empty directory
+		if os.Remove(parent) != nil {
+			return
+		}
+	}
+}
+
+// Total size of files under directory
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// Human readable size, like 1.5M
+func formatSize(size int64) string {
+	value := float64(size)
+	for _, unit := range []string{"B", "K", "M", "G"} {
+		if value < 1024 || unit == "G" {
+			if unit == "B" {
+				return fmt.Sprintf("%d%s", size, unit)
+			}
+			return fmt.Sprintf("%.1f%s", value, unit)
+		}
+		value /= 1024
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContribCache(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		err := exec.Command("git", "config", "hooks.contrib", filepath.Dir(origin)).Run()
+		assert.Nil(t, err)
+		contrib := getContribDir()
+		used := repoConfig{Name: "github.com/org/hooks", Rev: "v1"}
+		stale := repoConfig{Name: "github.com/org/hooks", Rev: "v2"}
+		other := repoConfig{Name: "github.com/org/other"}
+		for _, repo := range []repoConfig{used, stale, other} {
+			cloneContribRepo(t, origin, contrib, repo)
+		}
+
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks@v1": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+
+		// used by config of another project
+		config := filepath.Join(filepath.Dir(origin), "other.json")
+		err = ioutil.WriteFile(config, []byte(`{"pre-push": {"github.com/org/other": ["lint"]}}`), 0644)
+		assert.Nil(t, err)
+		assert.Nil(t, markUsed(other.dir(contrib), config))
+		logger.clear()
+
+		listContrib()
+		table := logger.infos[0].(string)
+		assert.True(t, strings.Contains(table, "REPO"))
+		assert.Regexp(t, `github.com/org/hooks@@v1 +[0-9.]+K +v1 +[0-9-]+ [0-9:]+\n`, table)
+		assert.Regexp(t, `github.com/org/hooks@@v2 +[0-9.]+K +v2-1-g[0-9a-f]+ +never\n`, table)
+		logger.clear()
+
+		pruneContrib()
+		assert.Equal(t, []interface{}{"Remove github.com/org/hooks@@v2, not referenced by any config", "\n"}, logger.infos)
+		for repo, expected := range map[*repoConfig]bool{&used: true, &stale: false, &other: true} {
+			isExist, _ := exists(repo.dir(contrib))
+			assert.Equal(t, expected, isExist, repo.String())
+		}
+		logger.clear()
+
+		// other project no longer use it
+		err = ioutil.WriteFile(config, []byte(`{}`), 0644)
+		assert.Nil(t, err)
+		pruneContrib()
+		isExist, _ := exists(other.dir(contrib))
+		assert.False(t, isExist)
+		isExist, _ = exists(filepath.Join(contrib, "github.com", "org"))
+		assert.True(t, isExist)
+		logger.clear()
+
+		// not used within age
+		pruneContrib("1ns")
+		isExist, _ = exists(filepath.Join(contrib, "github.com"))
+		assert.False(t, isExist)
+		logger.clear()
+
+		pruneContrib("forever")
+		assert.Equal(t, 2, len(logger.errors))
+		logger.clear()
+	})
+}
+
+func TestPruneFetched(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		_, err = gitExec("config hooks.contrib " + wd)
+		assert.Nil(t, err)
+		contrib := getContribDir()
+		repo := repoConfig{Name: "file://" + origin}
+		err = ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"`+repo.Name+`": ["lint"]}}`), 0644)
+		assert.Nil(t, err)
+
+		// prepared for offline use without running hooks
+		fetch()
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, []string{filepath.Join(wd, "githooks.json")}, getUsers(repo.dir(contrib)))
+		logger.clear()
+
+		lock()
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+
+		// prune in another project keeps repos fetched and locked
+		other := filepath.Join(wd, "other")
+		assert.Nil(t, os.Mkdir(other, 0755))
+		assert.Nil(t, os.Chdir(other))
+		defer os.Chdir(wd)
+		err = exec.Command("git", "init", "-q").Run()
+		assert.Nil(t, err)
+		_, err = gitExec("config hooks.contrib " + wd)
+		assert.Nil(t, err)
+
+		pruneContrib()
+		assert.Equal(t, 0, len(logger.infos))
+		isExist, _ := exists(repo.dir(contrib))
+		assert.True(t, isExist)
+		logger.clear()
+	})
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Create contrib repo under current directory with hook `lint` printing its version
+// v1 and v2 are tagged, master is at v3
+func createContribRepo(t *testing.T) string {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+
+	origin := filepath.Join(wd, "origin")
+	for i, version := range []string{"v1", "v2", "v3"} {
+		createHook(t, origin, "", "lint", "echo "+version+" >> run.out")
+		script := "git add lint && git commit -qm " + version
+		if i == 0 {
+			script = "git init -q && git config user.email a@b.c && git config user.name a && " + script
+		}
+		if version != "v3" {
+			script += " && git tag " + version
+		}
+		cmd := exec.Command("bash", "-c", script)
+		cmd.Dir = origin
+		out, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(out))
+	}
+	return origin
+}
+
+// Clone contrib repo as if it's fetched from remote
+func cloneContribRepo(t *testing.T, origin, contrib string, repo repoConfig) {
+	_, err := gitExecRaw("", nil, "clone", "--quiet", origin, repo.dir(contrib))
+	assert.Nil(t, err)
+}
+
+func TestParseRepo(t *testing.T) {
+	for key, expected := range map[string]repoConfig{
+		"github.com/org/hooks":             {Name: "github.com/org/hooks"},
+		"github.com/org/hooks@v1.2.0":      {Name: "github.com/org/hooks", Rev: "v1.2.0"},
+		"ssh://git@host.com:org/hooks":     {Name: "ssh://git@host.com:org/hooks"},
+		"ssh://git@host.com:org/hooks@abc": {Name: "ssh://git@host.com:org/hooks", Rev: "abc"},
+		"https://user@host.com/org/hooks":  {Name: "https://user@host.com/org/hooks"},
+		"github.com/org/hooks@":            {Name: "github.com/org/hooks@"},
+	} {
+		assert.Equal(t, expected, parseRepo(key), key)
+	}
+}
+
+func TestRunPinnedRev(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		contrib := filepath.Join(filepath.Dir(origin), "contrib")
+		for _, repo := range []repoConfig{
+			{Name: "github.com/org/hooks"},
+			{Name: "github.com/org/hooks", Rev: "v1"},
+			{Name: "github.com/org/hooks", Rev: "v2"},
+		} {
+			cloneContribRepo(t, origin, contrib, repo)
+		}
+
+		err := ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks@v1": ["lint"],
+				"github.com/org/hooks": {"rev": "v2", "hooks": ["lint"]}
+			},
+			"pre-push": {
+				"github.com/org/hooks": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+		r = newRunner(hookConfigs(), "pre-push", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+
+		out, err := ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "v1\nv2\nv3\n", string(out))
+		logger.clear()
+	})
+}
+
+func TestCheckoutRev(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		contrib := filepath.Join(filepath.Dir(origin), "contrib")
+		repo := repoConfig{Name: "github.com/org/hooks", Rev: "v4"}
+		cloneContribRepo(t, origin, contrib, repo)
+
+		// unknown revision
+		_, err := checkoutRepo(contrib, repo, false)
+		assert.NotNil(t, err)
+
+		// fetch revision created after clone
+		cmd := exec.Command("bash", "-c", "git tag v4 v1")
+		cmd.Dir = origin
+		assert.Nil(t, cmd.Run())
+		dir, err := checkoutRepo(contrib, repo, false)
+		assert.Nil(t, err)
+		v1, _ := gitExecWithDir(origin, "rev-parse v1")
+		head, _ := gitExecWithDir(dir, "rev-parse HEAD")
+		assert.Equal(t, v1, head)
+
+		// branch follows remote after update
+		repo = repoConfig{Name: "github.com/org/hooks", Rev: "master"}
+		cloneContribRepo(t, origin, contrib, repo)
+		cmd = exec.Command("bash", "-c", "git commit -q --allow-empty -m v4")
+		cmd.Dir = origin
+		assert.Nil(t, cmd.Run())
+		dir, err = checkoutRepo(contrib, repo, false)
+		assert.Nil(t, err)
+		assert.Nil(t, updateRepo(dir, repo.Rev))
+		master, _ := gitExecWithDir(origin, "rev-parse master")
+		head, _ = gitExecWithDir(dir, "rev-parse HEAD")
+		assert.Equal(t, master, head)
+	})
+}
+
+func TestAutoupdate(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		err := exec.Command("git", "config", "hooks.contrib", filepath.Dir(origin)).Run()
+		assert.Nil(t, err)
+		contrib := getContribDir()
+		for _, repo := range []repoConfig{
+			{Name: "github.com/org/hooks"},
+			{Name: "github.com/org/hooks", Rev: "v1"},
+			{Name: "github.com/org/other", Rev: "v1"},
+		} {
+			cloneContribRepo(t, origin, contrib, repo)
+		}
+
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"parallel": true,
+				"github.com/org/hooks@v1": ["lint"],
+				"github.com/org/other": {"rev":"v1", "hooks": ["lint"]}
+			},
+			"pre-push": {
+				"github.com/org/hooks": [{"name": "lint"}]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		autoupdate()
+		assert.Equal(t, 0, len(logger.errors))
+		content, err := ioutil.ReadFile("githooks.json")
+		assert.Nil(t, err)
+		assert.Equal(t, `{
+			"pre-commit": {
+				"parallel": true,
+				"github.com/org/hooks@v2": ["lint"],
+				"github.com/org/other": {"rev":"v2", "hooks": ["lint"]}
+			},
+			"pre-push": {
+				"github.com/org/hooks@v2": [{"name": "lint"}]
+			}
+		}`, string(content))
+
+		v1, _ := gitExecWithDir(origin, "rev-parse v1")
+		v2, _ := gitExecWithDir(origin, "rev-parse v2")
+		assert.Contains(t, logger.infos, "Update github.com/org/hooks@@v1 to v2")
+		assert.Contains(t, logger.infos, "  "+v1+".."+v2)
+		logger.clear()
+
+		// nothing to update
+		cloneContribRepo(t, origin, contrib, repoConfig{Name: "github.com/org/hooks", Rev: "v2"})
+		cloneContribRepo(t, origin, contrib, repoConfig{Name: "github.com/org/other", Rev: "v2"})
+		autoupdate()
+		assert.Contains(t, logger.infos, "github.com/org/hooks@@v2 is up to date at v2 ("+v2+")")
+		logger.clear()
+	})
+}
+
+func TestOffline(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		err := exec.Command("git", "config", "hooks.contrib", filepath.Dir(origin)).Run()
+		assert.Nil(t, err)
+		contrib := getContribDir()
+		repo := repoConfig{Name: "github.com/org/hooks", Rev: "v4"}
+		cloneContribRepo(t, origin, contrib, repo)
+
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks@v4": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		// revision created after clone
+		cmd := exec.Command("git", "tag", "v4", "v1")
+		cmd.Dir = origin
+		assert.Nil(t, cmd.Run())
+
+		err = exec.Command("git", "config", "hooks.offline", "true").Run()
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string), "revision v4 not found"))
+		logger.clear()
+
+		fetch()
+		assert.Equal(t, MESSAGES["Offline"], logger.errors[0])
+		logger.clear()
+
+		// fetch while online
+		err = exec.Command("git", "config", "hooks.offline", "false").Run()
+		assert.Nil(t, err)
+		fetch()
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Contains(t, logger.infos, "Fetched github.com/org/hooks@@v4")
+		logger.clear()
+
+		err = exec.Command("git", "config", "hooks.offline", "true").Run()
+		assert.Nil(t, err)
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.Equal(t, 0, len(logger.errors))
+		out, err := ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "v1\n", string(out))
+		logger.clear()
+
+		// missing repo never cloned
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/missing": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string), "github.com/org/missing not found"))
+		assert.Equal(t, 0, len(logger.infos))
+		logger.clear()
+	})
+}
+
+func TestRunLocalRepo(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		createHook(t, "hooks-dev", "", "lint", "echo relative >> run.out")
+		createHook(t, filepath.Join(wd, "other-dev"), "", "lint", "echo absolute >> run.out")
+
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"./hooks-dev": ["lint"],
+				"`+filepath.Join(wd, "other-dev")+`": ["lint"]
+			},
+			"pre-push": {
+				"./missing": ["lint"],
+				"./hooks-dev@v1": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		// used in place, even if lock file exists
+		err = ioutil.WriteFile("githooks.lock", []byte(`{}`), 0644)
+		assert.Nil(t, err)
+		contrib := filepath.Join(wd, "contrib")
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+		assert.Equal(t, 0, len(logger.errors))
+		out, err := ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "relative\nabsolute\n", string(out))
+		isExist, _ := exists(contrib)
+		assert.False(t, isExist)
+		logger.clear()
+
+		r = newRunner(hookConfigs(), "pre-push", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.HasSuffix(logger.warns[0].(string), "missing not found"))
+		assert.True(t, strings.Contains(logger.warns[2].(string), "revision can't be pinned"))
+		logger.clear()
+	})
+}
+
+func TestRepoLock(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		dir := filepath.Join(wd, "contrib", "github.com", "org", "hooks")
+
+		// holder takes lock first, it never waits or logs
+		locked := make(chan bool)
+		released := make(chan bool)
+		done := make(chan error)
+		go func() {
+			done <- withRepoLock(dir, func() error {
+				locked <- true
+				time.Sleep(100 * time.Millisecond)
+				close(released)
+				return nil
+			})
+		}()
+
+		<-locked
+		err = withRepoLock(dir, func() error {
+			select {
+			case <-released:
+			default:
+				t.Error("lock taken before released")
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, <-done)
+		assert.Contains(t, logger.infos, "Waiting for another git-hooks using "+dir)
+		logger.clear()
+	})
+}
+
+func TestCloneRepo(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		contrib := filepath.Join(filepath.Dir(origin), "contrib")
+
+		// clone into place
+		repo := repoConfig{Name: "file://" + origin, Rev: "v1"}
+		dir, err := checkoutRepo(contrib, repo, false)
+		assert.Nil(t, err)
+		v1, _ := gitExecWithDir(origin, "rev-parse v1")
+		head, _ := gitExecWithDir(dir, "rev-parse HEAD")
+		assert.Equal(t, v1, head)
+
+		// nothing left if clone failed
+		repo = repoConfig{Name: "file://" + origin, Rev: "v9"}
+		_, err = checkoutRepo(contrib, repo, false)
+		assert.NotNil(t, err)
+		isExist, _ := exists(repo.dir(contrib))
+		assert.False(t, isExist)
+
+		files, err := ioutil.ReadDir(filepath.Dir(dir))
+		assert.Nil(t, err)
+		names := make([]string, 0)
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		assert.Equal(t, []string{"origin@v1", "origin@v1.lock", "origin@v9.lock"}, names)
+		logger.clear()
+	})
+}
+
+func TestAllowedSources(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		contrib := filepath.Join(filepath.Dir(origin), "contrib")
+		cloneContribRepo(t, origin, contrib, repoConfig{Name: "github.com/org/hooks", Rev: "v1"})
+
+		global := filepath.Join(filepath.Dir(origin), "gitconfig")
+		defer os.Unsetenv("GIT_CONFIG_GLOBAL")
+		defer os.Unsetenv("GIT_CONFIG_NOSYSTEM")
+		os.Setenv("GIT_CONFIG_GLOBAL", global)
+		os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+		// every source allowed by default
+		assert.Nil(t, getAllowedSources())
+
+		for _, pattern := range []string{"github.com/org/*", "example.com/**"} {
+			err := exec.Command("git", "config", "--global", "--add", "hooks.allowedSources", pattern).Run()
+			assert.Nil(t, err)
+		}
+		// repo can't allow sources by itself
+		err := exec.Command("git", "config", "--local", "hooks.allowedSources", "**").Run()
+		assert.Nil(t, err)
+		allowed := getAllowedSources()
+		assert.Equal(t, []string{"github.com/org/*", "example.com/**"}, allowed)
+
+		for name, ok := range map[string]bool{
+			"github.com/org/hooks@v1":      true,
+			"https://github.com/org/hooks": true,
+			"git@github.com:org/hooks":     true,
+			"example.com/group/sub/hooks":  true,
+			"github.com/other/hooks":       false,
+			"github.com/org/hooks/nested":  false,
+			"../hooks":                     false,
+		} {
+			assert.Equal(t, ok, checkSource(parseRepo(name), "githooks.json", allowed) == nil, name)
+		}
+
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks@v1": ["lint"],
+				"github.com/other/hooks": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string),
+			"github.com/other/hooks referenced by "+hookConfigs()["project"]+" is not allowed"))
+		isExist, _ := exists("run.out")
+		assert.False(t, isExist)
+		isExist, _ = exists(filepath.Join(contrib, "github.com", "other"))
+		assert.False(t, isExist)
+		logger.clear()
+	})
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/cattail/go-exclude"
 	"github.com/mitchellh/go-homedir"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 // list directories for project, user and global scopes
@@ -178,16 +183,214 @@ func listHooksInDir(scope, dirname string) (hooks map[string][]string, err error
 	return hooks, nil
 }
 
+// Hooks and options of a trigger in config file
+// Repos and hooks run in the order they are declared
+// Example:
+// {
+//     "pre-commit": {
+//         "parallel": 4,
+//         "keepgoing": true,
+//         "github.com/git-hooks/contrib": [
+//             {"name": "gofmt", "before": ["golint"], "fix": true},
+//             "golint",
+//             {"name": "whitespace", "timeout": "30s"},
+//             {"name": "bashlint", "files": ["*.sh"], "exclude": ["vendor/**"]}
+//         ],
+//         "github.com/org/hooks@v1.2.0": ["lint"],
+//         "github.com/org/other": {"rev": "release/1.x", "hooks": ["lint"]},
+//         "github.com/org/signed@v2.0.0": {"signed": true, "tree": "9bc1...", "hooks": [{"name": "lint", "sha256": "4f2a..."}]},
+//         "../hooks": ["lint"]
+//     }
+// }
+type triggerConfig struct {
+	// worker limit for parallel mode, 0 if not configured
+	Parallel parallelism
+	// run every hook even after failure, nil if not configured
+	KeepGoing *bool
+	// stash unstaged changes around pre-commit hooks, nil if not configured
+	Stash *bool
+	// skip pre-commit hooks passed on the same index, nil if not configured
+	Cache *bool
+	// hooks grouped by contrib repo
+	Repos []repoConfig
+}
+
+// Contrib repo and its hooks in config file,
+// either a list of hooks or an object with options
+type repoConfig struct {
+	Name string `json:"-"`
+	// tag, branch or commit to check out, empty to follow default branch
+	Rev   string       `json:"rev"`
+	Hooks []hookConfig `json:"hooks"`
+	// git tree id of checked out revision, verified before hooks run
+	Tree string `json:"tree"`
+	// verify signature of pinned tag or checked out commit
+	Signed bool `json:"signed"`
+	// key and value as declared in config file
+	key   string
+	value json.RawMessage
+	// directory of config file, local repo path is relative to it
+	base string
+}
+
+// Parse repo key in config file
+// Revision is pinned after the last `@`, like `github.com/org/hooks@v1.2.0`,
+// as long as it can't be part of the address, e.g. `git@host:org/repo`
+// Use object form to pin revisions containing `/` or `:`
+func parseRepo(key string) repoConfig {
+	if i := strings.LastIndex(key, "@"); i > 0 {
+		rev := key[i+1:]
+		if rev != "" && !strings.ContainsAny(rev, "/:") {
+			return repoConfig{Name: key[:i], Rev: rev}
+		}
+	}
+	return repoConfig{Name: key}
+}
+
+func (repo *repoConfig) UnmarshalJSON(data []byte) error {
+	// decide form by the value, so errors inside hooks are not masked
+	if isJSONKind(data, '[') {
+		return json.Unmarshal(data, &repo.Hooks)
+	}
+
+	// avoid recursion
+	type plain repoConfig
+	return json.Unmarshal(data, (*plain)(repo))
+}
+
+// Name of repo with pinned revision
+func (repo repoConfig) String() string {
+	if repo.Rev == "" {
+		return repo.Name
+	}
+	return repo.Name + "@" + repo.Rev
+}
+
+// Contrib hook in config file, either a hook name or an object with options
+type hookConfig struct {
+	Name string `json:"name"`
+	// kill hook if not finished in time, 0 if not configured
+	Timeout duration `json:"timeout"`
+	// names of hooks that must run after this one
+	Before []string `json:"before"`
+	// names of hooks that must run before this one
+	After []string `json:"after"`
+	// glob patterns of staged files the hook care about
+	Files   []string `json:"files"`
+	Exclude []string `json:"exclude"`
+	// hook fix staged files, like gofmt -w
+	Fix bool `json:"fix"`
+	// hex encoded sha256 of hook file, verified before hooks run
+	Sha256 string `json:"sha256"`
+}
+
+func (hook *hookConfig) UnmarshalJSON(data []byte) error {
+	if isJSONKind(data, '"') {
+		return json.Unmarshal(data, &hook.Name)
+	}
+
+	// avoid recursion
+	type plain hookConfig
+	return json.Unmarshal(data, (*plain)(hook))
+}
+
+// Trigger options share the namespace with contrib repos,
+// every key not listed here is treated as a repo
+func (config *triggerConfig) UnmarshalJSON(data []byte) error {
+	config.Repos = make([]repoConfig, 0)
+	return eachMember(data, func(key string, value json.RawMessage) error {
+		switch key {
+		case "parallel":
+			return json.Unmarshal(value, &config.Parallel)
+		case "keepgoing":
+			return json.Unmarshal(value, &config.KeepGoing)
+		case "stash":
+			return json.Unmarshal(value, &config.Stash)
+		case "cache":
+			return json.Unmarshal(value, &config.Cache)
+		}
+
+		repo := parseRepo(key)
+		if err := json.Unmarshal(value, &repo); err != nil {
+			return err
+		}
+		repo.key, repo.value = key, value
+		config.Repos = append(config.Repos, repo)
+		return nil
+	})
+}
+
+// Whether JSON value start with delim, like `[` for array
+func isJSONKind(data []byte, delim byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) != 0 && data[0] == delim
+}
+
+// Iterate members of JSON object in the order they are declared
+func eachMember(data []byte, fn func(key string, value json.RawMessage) error) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expect JSON object, got %s", data)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+
+		if err := fn(token.(string), value); err != nil {
+			return err
+		}
+	}
+
+	// closing delim
+	_, err = decoder.Token()
+	return err
+}
+
+// List triggers in alphabetical order
+// Semi scope trigger like `_pre-commit` come before `pre-commit`
+func sortedTriggers(hooks interface{}) []string {
+	triggers := make([]string, 0)
+	for _, key := range reflect.ValueOf(hooks).MapKeys() {
+		triggers = append(triggers, key.String())
+	}
+	sort.Strings(triggers)
+	return triggers
+}
+
 // List available hooks configured by config file
-func listHooksInConfig(config string) (hooks map[string]map[string][]string, err error) {
-	hooks = make(map[string]map[string][]string)
+func listHooksInConfig(config string) (hooks map[string]*triggerConfig, err error) {
+	hooks = make(map[string]*triggerConfig)
 
 	file, err := ioutil.ReadFile(config)
 	if err != nil {
 		return
 	}
 
-	json.Unmarshal(file, &hooks)
+	// a typo in options must not silently turn off hooks of the trigger
+	if err = json.Unmarshal(file, &hooks); err != nil {
+		err = fmt.Errorf("%s: %s", config, err)
+		return
+	}
+	for _, options := range hooks {
+		if options == nil {
+			continue
+		}
+		for i := range options.Repos {
+			options.Repos[i].base = filepath.Dir(config)
+		}
+	}
 	return
 }
 
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Result of checks run by doctor
+type diagnosis struct {
+	problems int
+}
+
+func (d *diagnosis) pass(check string) {
+	logger.Infoln("[ok]   " + escapeColor(check))
+}
+
+func (d *diagnosis) fail(check string, fix string) {
+	d.problems++
+	logger.Warnln("[fail] " + escapeColor(check))
+	logger.Infoln("       fix: " + escapeColor(fix))
+}
+
+// Diagnose why hooks don't fire, print each check with suggested fix
+// Exit with non-zero status if any check fails
+func doctor() {
+	d := &diagnosis{}
+
+	d.checkExecutable()
+	d.checkTemplateDir()
+	if _, err := getGitDirPath(); err != nil {
+		d.fail(MESSAGES["NotGitRepo"], "Run 'git hooks doctor' inside a git repo")
+	} else {
+		d.checkHooksPath()
+		d.checkShims()
+		d.checkStash()
+		d.checkHookDirs()
+		d.checkHookConfigs()
+	}
+
+	if d.problems != 0 {
+		logger.Errorln(fmt.Sprintf("%d problems found", d.problems))
+		return
+	}
+	logger.Infoln("No problems found")
+}
+
+// Shims run `git-hooks`, git prepend its exec path to PATH of hooks
+func (d *diagnosis) checkExecutable() {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if execPath, err := gitExec("--exec-path"); err == nil {
+		dirs = append([]string{execPath}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		info, err := os.Stat(filepath.Join(dir, NAME))
+		if err == nil && !info.IsDir() && isExecutable(info) {
+			d.pass(NAME + " found in PATH of git: " + filepath.Join(dir, NAME))
+			return
+		}
+	}
+	d.fail(NAME+" not found in PATH of git", "Add directory of "+NAME+" to PATH")
+}
+
+// New repos get shims from init.templatedir, unnecessary with global core.hooksPath
+func (d *diagnosis) checkTemplateDir() {
+	if isHooksPathInstalled(true) {
+		d.pass("Global core.hooksPath points to shims of " + NAME)
+		return
+	}
+
+	templatedir, err := gitExec(GIT["GetTemplateDir"])
+	if err != nil || templatedir == "" {
+		d.fail("init.templatedir not set, new repos don't get "+NAME, "Run 'git hooks install-global'")
+		return
+	}
+	if !isShim(filepath.Join(templatedir, "hooks", "pre-commit"), tplPreInstall) {
+		d.fail("init.templatedir "+templatedir+" has no shims of "+NAME, "Run 'git hooks install-global'")
+		return
+	}
+	d.pass("init.templatedir is set to " + templatedir)
+}
+
+// Hooks directory is ignored by git if core.hooksPath point elsewhere
+func (d *diagnosis) checkHooksPath() {
+	hooksPath, err := gitExec("config --get core.hooksPath")
+	if err != nil || hooksPath == "" {
+		d.pass("core.hooksPath not set")
+		return
+	}
+	if isHooksPathInstalled(false) || isHooksPathInstalled(true) {
+		d.pass("core.hooksPath points to shims of " + NAME)
+		return
+	}
+	if installed, _ := isInstalled(); installed {
+		d.pass("core.hooksPath " + hooksPath + " contains shims of " + NAME)
+		return
+	}
+	d.fail("core.hooksPath is set to "+hooksPath+", hooks directory is ignored by git",
+		"Run 'git config --unset core.hooksPath' or 'git hooks install --hooks-path'")
+}
+
+// Every trigger supported by git should have an executable shim
+// identical to the installed template
+func (d *diagnosis) checkShims() {
+	hooks, err := getHooksDir()
+	if err != nil {
+		d.fail("Hooks directory not found", "Run 'git hooks install'")
+		return
+	}
+	if installed, _ := isInstalled(); !installed {
+		d.fail("Shims of "+NAME+" not installed in "+hooks, "Run 'git hooks install'")
+		return
+	}
+
+	var missing, modified, denied []string
+	for _, trigger := range supportedTriggers() {
+		path := filepath.Join(hooks, trigger)
+		info, err := os.Stat(path)
+		if err != nil {
+			missing = append(missing, trigger)
+		} else if !isShim(path, tplPostInstall) {
+			modified = append(modified, trigger)
+		} else if !isExecutable(info) {
+			denied = append(denied, path)
+		}
+	}
+
+	if len(missing) != 0 {
+		d.fail("Shims missing in "+hooks+": "+strings.Join(missing, ", "), "Run 'git hooks install' to add them")
+	}
+	if len(modified) != 0 {
+		d.fail("Hooks in "+hooks+" not installed by "+NAME+": "+strings.Join(modified, ", "),
+			"Move them into githooks directory and remove them, then run 'git hooks install'")
+	}
+	if len(denied) != 0 {
+		d.fail("Shims not executable: "+strings.Join(denied, ", "), "Run 'chmod +x "+strings.Join(denied, " ")+"'")
+	}
+	if len(missing)+len(modified)+len(denied) == 0 {
+		d.pass("Shims installed in " + hooks)
+	}
+}
+
+// Changes stashed by interrupted pre-commit hooks are hidden from work tree
+func (d *diagnosis) checkStash() {
+	s, err := leftoverStash()
+	if err != nil {
+		d.fail(fmt.Sprintf("Fail to check stashed changes: %s", err), "Check permission of git dir")
+		return
+	}
+	if s != nil {
+		d.fail("Changes stashed by an interrupted run are hidden in "+s.dir,
+			"Run 'git hooks run pre-commit' to restore them")
+		return
+	}
+	d.pass("No changes left stashed")
+}
+
+// Triggers should be run by git and files under them should be executable
+func (d *diagnosis) checkHookDirs() {
+	supported := supportedTriggers()
+	dirs := hookDirs()
+	for _, scope := range SCOPES {
+		dir, ok := dirs[scope]
+		if !ok {
+			continue
+		}
+		if scope == "project" && !isProjectTrusted() {
+			d.fail(MESSAGES["Untrusted"], "Run 'git hooks trust'")
+		}
+
+		triggers, err := ioutil.ReadDir(dir)
+		if err != nil {
+			d.fail(fmt.Sprintf("%s hooks %s: %s", scope, dir, err), "Fix permission of "+dir)
+			continue
+		}
+
+		problems := d.problems
+		for _, trigger := range triggers {
+			if !trigger.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, trigger.Name())
+			if !contains(TRIGGERS[:], trigger.Name()) {
+				d.fail(path+" is not a git trigger", "Rename it to a git trigger, like pre-commit")
+				continue
+			}
+			if !contains(supported, trigger.Name()) {
+				d.fail(path+" is not run by this version of git", "Upgrade git")
+				continue
+			}
+
+			hooks, err := ioutil.ReadDir(path)
+			if err != nil {
+				continue
+			}
+			for _, hook := range hooks {
+				if !hook.IsDir() && !isExecutable(hook) {
+					file := filepath.Join(path, hook.Name())
+					d.fail(file+" is not executable", "Run 'chmod +x "+file+"'")
+				}
+			}
+		}
+		if problems == d.problems {
+			d.pass(scope + " hooks in " + dir)
+		}
+	}
+}
+
+// Contrib repos should be allowed and reachable,
+// or cloned before in offline mode
+func (d *diagnosis) checkHookConfigs() {
+	contrib := getContribDir()
+	allowed := getAllowedSources()
+	offline := getOffline()
+	configs := hookConfigs()
+	for _, scope := range SCOPES {
+		config, ok := configs[scope]
+		if !ok {
+			continue
+		}
+
+		structure, err := listHooksInConfig(config)
+		if err != nil {
+			d.fail(err.Error(), "Fix syntax of "+config)
+			continue
+		}
+
+		locked, err := readLock(config)
+		if err != nil {
+			d.fail(err.Error(), "Run 'git hooks lock' to lock contrib repos again")
+			continue
+		}
+
+		checked := make(map[string]bool)
+		for _, trigger := range sortedTriggers(structure) {
+			for _, repo := range structure[trigger].Repos {
+				if checked[repo.String()] {
+					continue
+				}
+				checked[repo.String()] = true
+
+				if err := checkSource(repo, config, allowed); err != nil {
+					d.fail(err.Error(), "Ask admin to allow it in hooks.allowedSources, or remove it from "+config)
+					continue
+				}
+
+				dir := repo.dir(contrib)
+				// locked repo run at its locked commit
+				if pinned, ok := locked.pin(repo); ok && !repo.isLocal() {
+					dir = pinned.dir(contrib)
+				}
+				if repo.isLocal() || offline {
+					if isExist, _ := exists(dir); !isExist {
+						if repo.isLocal() {
+							d.fail(fmt.Sprintf("%s not found at %s", repo, dir), "Fix path of it in "+config)
+						} else {
+							d.fail(fmt.Sprintf("%s not found at %s in offline mode", repo, dir), "Run 'git hooks fetch' before going offline")
+						}
+						continue
+					}
+					d.pass(fmt.Sprintf("%s found at %s", repo, dir))
+					continue
+				}
+
+				fullGitAddress, _ := findProtocol(repo.Name)
+				if err := lsRemote(fullGitAddress); err != nil {
+					d.fail(fmt.Sprintf("%s is not reachable: %s", repo, err), "Check network and access to "+fullGitAddress)
+					continue
+				}
+				d.pass(fmt.Sprintf("%s is reachable", repo))
+			}
+		}
+	}
+}
+
+// Check remote repo is reachable without prompting for credentials
+func lsRemote(address string) error {
+	cmd := exec.Command("git", "ls-remote", "--quiet", address, "HEAD")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// first line of git error, like `ssh: Could not resolve hostname`
+		if message := strings.TrimSpace(string(out)); message != "" {
+			return fmt.Errorf("%s", strings.SplitN(message, "\n", 2)[0])
+		}
+		return err
+	}
+	return nil
+}
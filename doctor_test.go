@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		hooks := filepath.Join(wd, ".git", "hooks")
+
+		defer os.Unsetenv("GIT_CONFIG_GLOBAL")
+		os.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(wd, "gitconfig"))
+		defer os.Unsetenv("GIT_CONFIG_NOSYSTEM")
+		os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+		homeTemplate := DIRS["HomeTemplate"]
+		defer func() { DIRS["HomeTemplate"] = homeTemplate }()
+		DIRS["HomeTemplate"] = filepath.Join(wd, "template")
+		defer os.Setenv("PATH", os.Getenv("PATH"))
+		os.Setenv("PATH", filepath.Join(wd, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		// nothing set up
+		doctor()
+		assert.Contains(t, logger.warns, "[fail] init.templatedir not set, new repos don't get git-hooks")
+		assert.Contains(t, logger.warns, "[fail] Shims of git-hooks not installed in "+hooks)
+		assert.Contains(t, logger.infos, "[ok]   core.hooksPath not set")
+		assert.Equal(t, fmt.Sprintf("%d problems found", len(logger.warns)/2), logger.errors[0])
+		logger.clear()
+
+		// broken hooks
+		install(true)
+		installGlobal(wd)
+		createHook(t, "bin", "", NAME, "exit 0")
+		os.Remove(filepath.Join(hooks, "pre-push"))
+		createHook(t, "githooks", "pre-commit", "lint", "exit 0")
+		createHook(t, "githooks", "precommit", "lint", "exit 0")
+		err = ioutil.WriteFile(filepath.Join("githooks", "pre-commit", "readme"), []byte("lint"), 0644)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"./missing": ["lint"]}}`), 0644)
+		assert.Nil(t, err)
+		logger.clear()
+
+		doctor()
+		assert.Contains(t, logger.infos, "[ok]   "+NAME+" found in PATH of git: "+filepath.Join(wd, "bin", NAME))
+		assert.Contains(t, logger.infos, "[ok]   init.templatedir is set to "+DIRS["HomeTemplate"])
+		assert.Contains(t, logger.warns, "[fail] Shims missing in "+hooks+": pre-push")
+		assert.Contains(t, logger.warns, "[fail] "+MESSAGES["Untrusted"])
+		assert.Contains(t, logger.warns, "[fail] "+filepath.Join(wd, "githooks", "pre-commit", "readme")+" is not executable")
+		assert.Contains(t, logger.warns, "[fail] "+filepath.Join(wd, "githooks", "precommit")+" is not a git trigger")
+		assert.Contains(t, logger.warns, "[fail] ./missing not found at "+filepath.Join(wd, "missing"))
+		assert.Equal(t, "5 problems found", logger.errors[0])
+		logger.clear()
+
+		// fixed
+		install(true)
+		os.Chmod(filepath.Join("githooks", "pre-commit", "readme"), 0755)
+		os.RemoveAll(filepath.Join("githooks", "precommit"))
+		createHook(t, "missing", "pre-commit", "lint", "exit 0")
+		trust()
+		logger.clear()
+
+		doctor()
+		assert.Equal(t, 0, len(logger.warns))
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Contains(t, logger.infos, "[ok]   Shims installed in "+hooks)
+		assert.Contains(t, logger.infos, "[ok]   ./missing found at "+filepath.Join(wd, "missing"))
+		assert.Equal(t, "No problems found", logger.infos[len(logger.infos)-2])
+		logger.clear()
+
+		// hooks directory ignored
+		_, err = gitExec("config core.hooksPath elsewhere")
+		assert.Nil(t, err)
+		doctor()
+		assert.Contains(t, logger.warns, "[fail] core.hooksPath is set to elsewhere, hooks directory is ignored by git")
+		logger.clear()
+
+		// malformed config
+		_, err = gitExec("config --unset core.hooksPath")
+		assert.Nil(t, err)
+		err = ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"./missing": [{"name": "lint", "timeout": "soon"}]}}`), 0644)
+		assert.Nil(t, err)
+		trust()
+		logger.clear()
+		config := hookConfigs()["project"]
+		doctor()
+		assert.Equal(t, []interface{}{"[fail] " + config + `: invalid duration "soon"`, "\n"}, logger.warns)
+		assert.Contains(t, logger.infos, "       fix: Fix syntax of "+config)
+		assert.Equal(t, "1 problems found", logger.errors[0])
+		logger.clear()
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Staged files watched around a fix hook
+type fixup struct {
+	job       *hookJob
+	root      string
+	autoStage bool
+	// content hash of files before hook run
+	hashes map[string]string
+	// files with unstaged changes before hook run, unsafe to re-stage
+	dirty map[string]bool
+}
+
+func (r *runner) prepareFix(job *hookJob) *fixup {
+	fix := &fixup{
+		job:       job,
+		root:      r.root,
+		autoStage: r.autoStage,
+		hashes:    hashFiles(r.root, job.files),
+		dirty:     make(map[string]bool),
+	}
+
+	out, err := gitExecPaths(r.root, []string{"diff", "--name-only", "-z"}, job.files)
+	if err == nil {
+		for _, file := range bytes.Split(out, []byte{0}) {
+			fix.dirty[string(file)] = true
+		}
+	}
+	return fix
+}
+
+// Re-stage files modified by hook,
+// print their diff and fail instead if auto stage is disabled
+func (fix *fixup) apply(output io.Writer) error {
+	hashes := hashFiles(fix.root, fix.job.files)
+	modified := make([]string, 0)
+	for _, file := range fix.job.files {
+		if hashes[file] != fix.hashes[file] {
+			modified = append(modified, file)
+		}
+	}
+	if len(modified) == 0 {
+		return nil
+	}
+
+	if !fix.autoStage {
+		diff, _ := gitExecPaths(fix.root, []string{"diff", "--no-color", "--no-ext-diff"}, modified)
+		output.Write(diff)
+		return fmt.Errorf("%s modified staged files, review and stage them: %s",
+			fix.job.name, strings.Join(modified, ", "))
+	}
+
+	// re-stage would include changes not meant to be committed
+	unsafe := make([]string, 0)
+	for _, file := range modified {
+		if fix.dirty[file] {
+			unsafe = append(unsafe, file)
+		}
+	}
+	if len(unsafe) != 0 {
+		return fmt.Errorf("%s modified files with unstaged changes, enable hooks.stash to re-stage them: %s",
+			fix.job.name, strings.Join(unsafe, ", "))
+	}
+
+	// paths from stdin are taken literally and never hit argument size limit
+	input := []byte(strings.Join(modified, "\x00") + "\x00")
+	if _, err := gitExecRaw(fix.root, input, "update-index", "--add", "--remove", "-z", "--stdin"); err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "Re-stage files modified by %s: %s\n", fix.job.name, strings.Join(modified, ", "))
+	return nil
+}
+
+// Run git command on files as literal pathspecs, so names like a[1].go don't match other files
+// Files are split into batches to stay under argument size limit of large commits
+func gitExecPaths(dir string, args []string, files []string) ([]byte, error) {
+	var out []byte
+	for len(files) != 0 {
+		count, size := 0, 0
+		for count < len(files) && (count == 0 || size+len(files[count]) < 128*1024) {
+			size += len(files[count]) + 1
+			count++
+		}
+
+		batch := append(append([]string{"--literal-pathspecs"}, args...), "--")
+		chunk, err := gitExecRaw(dir, nil, append(batch, files[:count]...)...)
+		out = append(out, chunk...)
+		if err != nil {
+			return out, err
+		}
+		files = files[count:]
+	}
+	return out, nil
+}
+
+// Content hash of files in work tree, empty for missing file
+func hashFiles(root string, files []string) map[string]string {
+	hashes := make(map[string]string)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join(root, file))
+		if err == nil {
+			hashes[file] = fmt.Sprintf("%x", sha1.Sum(content))
+		}
+	}
+	return hashes
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create repo with staged file and a contrib fix hook replacing `bad` with `good`
+func createFixRepo(t *testing.T, context func(tempdir, contrib string)) {
+	createGitRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		echo bad > a.go;
+		echo bad > b.txt;
+		git add a.go b.txt;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+
+		contrib := filepath.Join(tempdir, "contrib")
+		createHook(t, filepath.Join(contrib, "github.com", "org", "hooks"), "", "gofmt",
+			`tr '\0' '\n' < "$GIT_HOOKS_STAGED_FILE_LIST" | xargs sed -i s/bad/good/`)
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks": [{"name": "gofmt", "files": ["*.go"], "fix": true}]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		context(tempdir, contrib)
+	})
+}
+
+func TestRunFix(t *testing.T) {
+	// re-stage modified files
+	createFixRepo(t, func(tempdir, contrib string) {
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+
+		staged, err := gitExec("show :a.go")
+		assert.Nil(t, err)
+		assert.Equal(t, "good", staged)
+
+		// not matched files untouched
+		staged, err = gitExec("show :b.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, "bad", staged)
+		logger.clear()
+	})
+
+	// fail with diff if auto stage disabled
+	createFixRepo(t, func(tempdir, contrib string) {
+		err := exec.Command("git", "config", "hooks.autostage", "false").Run()
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, r.failed)
+		assert.True(t, strings.Contains(r.results[0].err.Error(), "a.go"))
+
+		staged, err := gitExec("show :a.go")
+		assert.Nil(t, err)
+		assert.Equal(t, "bad", staged)
+		logger.clear()
+	})
+
+	// failed hook leave its edits unstaged
+	createFixRepo(t, func(tempdir, contrib string) {
+		createHook(t, filepath.Join(contrib, "github.com", "org", "hooks"), "", "gofmt",
+			`sed -i s/bad/partial/ a.go; exit 2`)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, r.failed)
+		assert.Equal(t, 2, r.results[0].status)
+
+		staged, err := gitExec("show :a.go")
+		assert.Nil(t, err)
+		assert.Equal(t, "bad", staged)
+		logger.clear()
+	})
+
+	// file names with glob characters only match themselves
+	createFixRepo(t, func(tempdir, contrib string) {
+		cmd := exec.Command("bash", "-c", `
+		echo bad > 'a[1].go';
+		echo bad > a1.go;
+		git add 'a[1].go' a1.go;
+		echo unstaged > a1.go;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+		createHook(t, filepath.Join(contrib, "github.com", "org", "hooks"), "", "gofmt",
+			`sed -i s/bad/good/ 'a[1].go'`)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+
+		staged, err := gitExecRaw("", nil, "show", ":a[1].go")
+		assert.Nil(t, err)
+		assert.Equal(t, "good\n", string(staged))
+		staged, err = gitExecRaw("", nil, "show", ":a1.go")
+		assert.Nil(t, err)
+		assert.Equal(t, "bad\n", string(staged))
+		logger.clear()
+	})
+
+	// refuse to re-stage files with unstaged changes
+	createFixRepo(t, func(tempdir, contrib string) {
+		err := ioutil.WriteFile("a.go", []byte("bad\nunstaged\n"), 0644)
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, r.failed)
+		assert.True(t, strings.Contains(r.results[0].err.Error(), "unstaged"))
+
+		staged, err := gitExec("show :a.go")
+		assert.Nil(t, err)
+		assert.Equal(t, "bad", staged)
+		logger.clear()
+	})
+}
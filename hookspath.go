@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory of shims pointed by core.hooksPath, managed by git-hooks
+// Local one lives in common git dir shared by worktrees, global one in home directory
+func getHooksPathDir(global bool) (string, error) {
+	if global {
+		dir := DIRS["HomeHooksPath"]
+		if filepath.IsAbs(dir) {
+			return dir, nil
+		}
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, dir), nil
+	}
+
+	gitDir, err := getAbsGitCommonDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, HOOKS_PATH_DIRNAME), nil
+}
+
+// Find core.hooksPath in local or global git config, empty if not set
+func getHooksPath(global bool) string {
+	out, err := gitExecRaw("", nil, "config", configScope(global), "--get", "core.hooksPath")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func configScope(global bool) string {
+	if global {
+		return "--global"
+	}
+	return "--local"
+}
+
+// Whether core.hooksPath of local or global git config point to shims of git-hooks
+func isHooksPathInstalled(global bool) bool {
+	dir, err := getHooksPathDir(global)
+	return err == nil && getHooksPath(global) == dir
+}
+
+// Install git-hooks by pointing core.hooksPath to shims managed by git-hooks,
+// hooks directory of git is left untouched
+// Global install take effect in every repo without local core.hooksPath
+func installHooksPath(global bool) {
+	dir, err := getHooksPathDir(global)
+	if err != nil {
+		logger.Errorln(MESSAGES["NotGitRepo"])
+		return
+	}
+
+	// don't take over hooks path of other tools
+	if current := getHooksPath(global); current != "" && current != dir {
+		logger.Errorln(MESSAGES["ExistHooksPath"] + current)
+		return
+	}
+
+	if err := writeShims(dir, tplPostInstall); err != nil {
+		logger.Errorln(err)
+		return
+	}
+	if _, err := gitExecRaw("", nil, "config", configScope(global), "core.hooksPath", dir); err != nil {
+		logger.Errorln("Fail to set core.hooksPath ", err)
+		return
+	}
+	logger.Infoln(MESSAGES["SetHooksPath"] + dir)
+}
+
+// Reverse installHooksPath, unset core.hooksPath and remove shims
+func uninstallHooksPath(global bool) {
+	if !isHooksPathInstalled(global) {
+		logger.Errorln(MESSAGES["NotExistHooksPath"])
+		return
+	}
+
+	dir, _ := getHooksPathDir(global)
+	if _, err := gitExecRaw("", nil, "config", configScope(global), "--unset", "core.hooksPath"); err != nil {
+		logger.Errorln("Fail to unset core.hooksPath ", err)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Errorln(err)
+		return
+	}
+	logger.Infoln(MESSAGES["UnsetHooksPath"])
+}
+
+// Write shim of every trigger supported by git into directory
+// Existing shims are kept so install can be run again to add new triggers,
+// hooks not installed by git-hooks are never overwritten
+func writeShims(dir string, template string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	installed := false
+	for _, hook := range supportedTriggers() {
+		path := filepath.Join(dir, hook)
+		if content, err := ioutil.ReadFile(path); err == nil {
+			if string(content) == template {
+				continue
+			}
+			if string(content) != tplPreInstall && string(content) != tplPostInstall {
+				logger.Warnln(MESSAGES["KeepHook"] + path)
+				continue
+			}
+		}
+
+		logger.Infoln("Install " + hook)
+		if err := ioutil.WriteFile(path, []byte(template), 0755); err != nil {
+			return err
+		}
+		// permission of existing file is kept by WriteFile
+		if err := os.Chmod(path, 0755); err != nil {
+			return err
+		}
+		installed = true
+	}
+	if !installed {
+		logger.Infoln(MESSAGES["UpToDate"] + dir)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallHooksPath(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		installHooksPath(false)
+		assert.Equal(t, 0, len(logger.errors))
+		gitDir, _ := getAbsGitDirPath()
+		dir := filepath.Join(gitDir, HOOKS_PATH_DIRNAME)
+		assert.Equal(t, dir, getHooksPath(false))
+		assert.Equal(t, MESSAGES["SetHooksPath"]+dir, logger.infos[len(logger.infos)-2])
+
+		// shims installed, hooks directory untouched
+		hook, err := ioutil.ReadFile(filepath.Join(dir, "pre-commit"))
+		assert.Nil(t, err)
+		assert.Equal(t, tplPostInstall, string(hook))
+		isExist, _ := exists(filepath.Join(gitDir, "hooks.old"))
+		assert.False(t, isExist)
+		installed, err := isInstalled()
+		assert.Nil(t, err)
+		assert.True(t, installed)
+		logger.clear()
+
+		list()
+		assert.Equal(t, MESSAGES["Installed"], logger.infos[0])
+		assert.Equal(t, MESSAGES["HooksPath"]+dir, logger.infos[2])
+		logger.clear()
+
+		// install twice
+		installHooksPath(false)
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+
+		uninstall()
+		assert.Equal(t, MESSAGES["UnsetHooksPath"], logger.infos[0])
+		assert.Equal(t, "", getHooksPath(false))
+		isExist, _ = exists(dir)
+		assert.False(t, isExist)
+		installed, _ = isInstalled()
+		assert.False(t, installed)
+		logger.clear()
+
+		// core.hooksPath owned by other tool
+		err = exec.Command("git", "config", "core.hooksPath", ".husky").Run()
+		assert.Nil(t, err)
+		installHooksPath(false)
+		assert.Equal(t, MESSAGES["ExistHooksPath"]+".husky", logger.errors[0])
+		logger.clear()
+		uninstallHooksPath(false)
+		assert.Equal(t, MESSAGES["NotExistHooksPath"], logger.errors[0])
+		assert.Equal(t, ".husky", getHooksPath(false))
+		logger.clear()
+
+		// hooks directory is ignored
+		install(true)
+		assert.Equal(t, MESSAGES["HooksPathIgnored"]+".husky", logger.warns[0])
+		logger.clear()
+	})
+}
+
+func TestInstallGlobalHooksPath(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		defer os.Unsetenv("GIT_CONFIG_GLOBAL")
+		os.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(wd, "gitconfig"))
+		homeHooksPath := DIRS["HomeHooksPath"]
+		defer func() { DIRS["HomeHooksPath"] = homeHooksPath }()
+		DIRS["HomeHooksPath"] = filepath.Join(wd, "home-hooks")
+
+		installHooksPath(true)
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, DIRS["HomeHooksPath"], getHooksPath(true))
+		assert.Equal(t, "", getHooksPath(false))
+		installed, err := isInstalled()
+		assert.Nil(t, err)
+		assert.True(t, installed)
+		logger.clear()
+
+		// local uninstall leave global one alone
+		uninstall()
+		assert.Equal(t, MESSAGES["NotExistHooks"], logger.errors[0])
+		logger.clear()
+
+		uninstallHooksPath(true)
+		assert.Equal(t, MESSAGES["UnsetHooksPath"], logger.infos[0])
+		assert.Equal(t, "", getHooksPath(true))
+		isExist, _ := exists(DIRS["HomeHooksPath"])
+		assert.False(t, isExist)
+		logger.clear()
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Hooks directories no longer run by git since git-hooks installed,
+// hooks.old backed up by install, and hooks directory ignored by git
+// if core.hooksPath is set
+func legacyHookDirs() []string {
+	dirs := make([]string, 0)
+	gitDir, err := getAbsGitCommonDirPath()
+	if err != nil {
+		return dirs
+	}
+
+	candidates := []string{filepath.Join(gitDir, "hooks.old")}
+	if hooksPath, err := gitExec("config --get core.hooksPath"); err == nil && hooksPath != "" {
+		candidates = append(candidates, filepath.Join(gitDir, "hooks"))
+	}
+	for _, dir := range candidates {
+		isExist, _ := exists(dir)
+		if isExist {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// List executable hooks named by their triggers in legacy hooks directory
+// Samples like pre-commit.sample and shims of git-hooks are excluded
+func listLegacyHooks(dir string) map[string]string {
+	hooks := make(map[string]string)
+	for _, trigger := range TRIGGERS {
+		path := filepath.Join(dir, trigger)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || !isExecutable(info) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil || string(content) == tplPostInstall || string(content) == tplPreInstall {
+			continue
+		}
+		hooks[trigger] = path
+	}
+	return hooks
+}
+
+// Run legacy hooks of trigger before other scopes,
+// they receive the same arguments and stdin as they did before install
+func runLegacyHooks(r *runner) {
+	jobs := make([]*hookJob, 0)
+	for _, dir := range legacyHookDirs() {
+		path, ok := listLegacyHooks(dir)[r.trigger]
+		if !ok {
+			continue
+		}
+
+		jobs = append(jobs, &hookJob{
+			scope:   "legacy",
+			id:      filepath.Base(dir),
+			name:    filepath.Join(filepath.Base(dir), r.trigger),
+			path:    path,
+			timeout: r.timeout,
+		})
+	}
+	r.execute(jobs)
+}
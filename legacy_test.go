@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunLegacyHooks(t *testing.T) {
+	refs := "refs/heads/master 67890 refs/heads/master 12345\n"
+
+	createGitRepo(t, func(tempdir string) {
+		// hooks existed before install
+		createHook(t, ".git", "hooks", "pre-push", `cat > legacy.out; echo "$@" >> legacy.out`)
+		err := ioutil.WriteFile(".git/hooks/pre-commit.sample", []byte("#!/bin/sh\nexit 1\n"), 0755)
+		assert.Nil(t, err)
+		install(true)
+		logger.clear()
+
+		assert.Equal(t, []string{".git/hooks.old"}, relPaths(t, legacyHookDirs()))
+		assert.Equal(t, []string{"pre-push"}, sortedTriggers(listLegacyHooks(legacyHookDirs()[0])))
+
+		withStdin(t, refs, func() {
+			run("pre-push", "origin", "git@example.com:org/repo")
+		})
+		assert.Equal(t, 0, len(logger.errors))
+		out, err := ioutil.ReadFile("legacy.out")
+		assert.Nil(t, err)
+		assert.Equal(t, refs+"origin git@example.com:org/repo\n", string(out))
+		logger.clear()
+
+		list()
+		assert.Contains(t, logger.infos, "legacy hooks")
+		assert.Contains(t, logger.infos, "    - hooks.old")
+		logger.clear()
+
+		// disabled like other hooks
+		disable("pre-push/hooks.old")
+		os.Remove("legacy.out")
+		withStdin(t, refs, func() {
+			run("pre-push", "origin", "git@example.com:org/repo")
+		})
+		isExist, _ := exists("legacy.out")
+		assert.False(t, isExist)
+		list()
+		assert.Contains(t, logger.infos, "    - hooks.old (disabled)")
+		logger.clear()
+	})
+
+	// hooks directory ignored by core.hooksPath
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, ".git", "hooks", "pre-commit", `echo legacy >> legacy.out`)
+		installHooksPath(false)
+		logger.clear()
+
+		assert.Equal(t, []string{".git/hooks"}, relPaths(t, legacyHookDirs()))
+		run("pre-commit")
+		out, err := ioutil.ReadFile("legacy.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "legacy\n", string(out))
+		logger.clear()
+
+		// shims never run as legacy hooks
+		install(true)
+		logger.clear()
+		assert.Equal(t, 0, len(listLegacyHooks(filepath.Join(".git", "hooks"))))
+	})
+}
+
+// Paths relative to current directory
+func relPaths(t *testing.T, paths []string) []string {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+
+	rels := make([]string, 0)
+	for _, path := range paths {
+		rel, err := filepath.Rel(wd, path)
+		assert.Nil(t, err)
+		rels = append(rels, rel)
+	}
+	return rels
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolved commits of contrib repos referenced by config file,
+// keyed by repo name with pinned revision
+// Stored next to config file, like githooks.json and githooks.lock
+type lockFile map[string]string
+
+func getLockPath(config string) string {
+	return strings.TrimSuffix(config, filepath.Ext(config)) + ".lock"
+}
+
+// Read lock file of config file, nil if not locked
+func readLock(config string) (lockFile, error) {
+	content, err := ioutil.ReadFile(getLockPath(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock := make(lockFile)
+	if err := json.Unmarshal(content, &lock); err != nil {
+		return nil, fmt.Errorf("%s: %s", getLockPath(config), err)
+	}
+	return lock, nil
+}
+
+func (lock lockFile) write(config string) error {
+	content, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getLockPath(config), append(content, '\n'), 0644)
+}
+
+// Contrib repo pinned to its locked commit, false if not locked
+// Locked commit is checked out in its own directory like pinned revisions,
+// so projects locking the same repo at different commits don't step on each other
+func (lock lockFile) pin(repo repoConfig) (repoConfig, bool) {
+	commit, ok := lock[repo.String()]
+	if !ok {
+		return repo, false
+	}
+	repo.Rev = commit
+	return repo, true
+}
+
+// Check checkout of contrib repo is at locked commit
+func (lock lockFile) verify(repo repoConfig, dir string) error {
+	locked, ok := lock[repo.String()]
+	if !ok {
+		return fmt.Errorf("%s is not locked, run `git hooks lock` to lock it", repo)
+	}
+
+	head, err := gitExecWithDir(dir, "rev-parse HEAD")
+	if err != nil {
+		return err
+	}
+	if head != locked {
+		return fmt.Errorf("%s is at %s but locked at %s, refuse to run mismatched hooks", repo, head, locked)
+	}
+	return nil
+}
+
+// Update contrib repos of project config and record their commits in lock file
+// Local repos are under development, they are not locked
+func lock() {
+	if getOffline() {
+		logger.Errorln(MESSAGES["Offline"])
+		return
+	}
+
+	config, ok := hookConfigs()["project"]
+	if !ok {
+		logger.Errorln(MESSAGES["NoProjectConfig"])
+		return
+	}
+
+	structure, err := listHooksInConfig(config)
+	if err != nil {
+		logger.Errorln(escapeColor(err.Error()))
+		return
+	}
+
+	contrib := getContribDir()
+	allowed := getAllowedSources()
+	locked := make(lockFile)
+	for _, trigger := range sortedTriggers(structure) {
+		for _, repo := range structure[trigger].Repos {
+			if _, ok := locked[repo.String()]; ok || repo.isLocal() {
+				continue
+			}
+
+			if err := checkSource(repo, config, allowed); err != nil {
+				logger.Errorln(escapeColor(err.Error()))
+				return
+			}
+
+			dir, err := checkoutRepo(contrib, repo, false)
+			if err == nil {
+				err = updateRepo(dir, repo.Rev)
+			}
+			if err != nil {
+				logger.Errorln(escapeColor(fmt.Sprintf("%s: %s", repo, err)))
+				return
+			}
+			markUsed(dir, config)
+
+			head, err := gitExecWithDir(dir, "rev-parse HEAD")
+			if err != nil {
+				logger.Errorln(err)
+				return
+			}
+			locked[repo.String()] = head
+			logger.Infoln(escapeColor(fmt.Sprintf("Lock %s at %s", repo, head)))
+		}
+	}
+
+	if err := locked.write(config); err != nil {
+		logger.Errorln(err)
+		return
+	}
+	logger.Infoln(MESSAGES["Locked"] + getLockPath(config))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		err := exec.Command("git", "config", "hooks.contrib", filepath.Dir(origin)).Run()
+		assert.Nil(t, err)
+		contrib := getContribDir()
+		pinned := repoConfig{Name: "github.com/org/hooks", Rev: "v1"}
+		unpinned := repoConfig{Name: "github.com/org/hooks"}
+		cloneContribRepo(t, origin, contrib, pinned)
+		cloneContribRepo(t, origin, contrib, unpinned)
+
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks@v1": ["lint"],
+				"github.com/org/hooks": ["lint"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		// new commit after clone
+		cmd := exec.Command("git", "commit", "-q", "--allow-empty", "-m", "v4")
+		cmd.Dir = origin
+		assert.Nil(t, cmd.Run())
+
+		lock()
+		assert.Equal(t, 0, len(logger.errors))
+		locked, err := readLock("githooks.json")
+		assert.Nil(t, err)
+		v1, _ := gitExecWithDir(origin, "rev-parse v1")
+		master, _ := gitExecWithDir(origin, "rev-parse master")
+		assert.Equal(t, lockFile{"github.com/org/hooks@v1": v1, "github.com/org/hooks": master}, locked)
+		logger.clear()
+
+		// new commit after lock, locked commits are checked out in their own dirs
+		cmd = exec.Command("bash", "-c", "echo v5 >> run.out > lint && git commit -qam v5")
+		cmd.Dir = origin
+		out, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(out))
+		v1Locked, _ := locked.pin(pinned)
+		masterLocked, _ := locked.pin(unpinned)
+		assert.NotEqual(t, masterLocked.dir(contrib), unpinned.dir(contrib))
+		cloneContribRepo(t, origin, contrib, v1Locked)
+		cloneContribRepo(t, origin, contrib, masterLocked)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.Equal(t, 0, len(logger.errors))
+		out, err = ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "v1\nv3\n", string(out))
+		head, _ := gitExecWithDir(masterLocked.dir(contrib), "rev-parse HEAD")
+		assert.Equal(t, master, head)
+		os.Remove("run.out")
+		logger.clear()
+
+		// checkout moved away from lock is checked out at locked commit again
+		_, err = gitExecWithDir(masterLocked.dir(contrib), "checkout -q HEAD~1")
+		assert.Nil(t, err)
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.Equal(t, 0, len(logger.errors))
+		head, _ = gitExecWithDir(masterLocked.dir(contrib), "rev-parse HEAD")
+		assert.Equal(t, master, head)
+		os.Remove("run.out")
+		logger.clear()
+
+		// locked dirs are referenced by config
+		assert.True(t, isReferenced(contrib, masterLocked.dir(contrib), []string{"githooks.json"}))
+		assert.True(t, isReferenced(contrib, v1Locked.dir(contrib), []string{"githooks.json"}))
+
+		// locked commit can't be obtained
+		missing := strings.Repeat("0", 40)
+		err = lockFile{"github.com/org/hooks@v1": v1, "github.com/org/hooks": missing}.write("githooks.json")
+		assert.Nil(t, err)
+		missingLocked := repoConfig{Name: "github.com/org/hooks", Rev: missing}
+		cloneContribRepo(t, origin, contrib, missingLocked)
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string), "locked at "+missing+" can't be checked out"))
+		isExist, _ := exists("run.out")
+		assert.False(t, isExist)
+		logger.clear()
+
+		// repo not in lock
+		err = ioutil.WriteFile("githooks.lock", []byte(`{}`), 0644)
+		assert.Nil(t, err)
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string), "not locked"))
+		logger.clear()
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/wsxiaoys/terminal/color"
+	"io"
 	"os"
 )
 
@@ -10,6 +11,17 @@ type Logger struct {
 	errors []interface{}
 	infos  []interface{}
 	warns  []interface{}
+	// called before exit on error
+	cleanups []func()
+	// stdout if nil, protocol triggers leave stdout to their hook
+	out io.Writer
+}
+
+func (logger *Logger) writer() io.Writer {
+	if logger.out == nil {
+		return os.Stdout
+	}
+	return logger.out
 }
 
 func (logger *Logger) Error(msgs ...interface{}) {
@@ -23,10 +35,18 @@ func (logger *Logger) Errors(status int, msgs ...interface{}) {
 	}
 
 	msgs = append([]interface{}{"@r"}, msgs...)
-	color.Print(msgs...)
+	color.Fprint(logger.writer(), msgs...)
+	for i := len(logger.cleanups) - 1; i >= 0; i-- {
+		logger.cleanups[i]()
+	}
 	os.Exit(status)
 }
 
+// Register function to be called before exit on error
+func (logger *Logger) OnExit(cleanup func()) {
+	logger.cleanups = append(logger.cleanups, cleanup)
+}
+
 func (logger *Logger) Warn(msgs ...interface{}) {
 	if isTestEnv() {
 		logger.warns = append(logger.warns, msgs...)
@@ -34,7 +54,7 @@ func (logger *Logger) Warn(msgs ...interface{}) {
 	}
 
 	msgs = append([]interface{}{"@y"}, msgs...)
-	color.Print(msgs...)
+	color.Fprint(logger.writer(), msgs...)
 }
 
 func (logger *Logger) Info(msgs ...interface{}) {
@@ -43,7 +63,7 @@ func (logger *Logger) Info(msgs ...interface{}) {
 		return
 	}
 
-	color.Print(msgs...)
+	color.Fprint(logger.writer(), msgs...)
 }
 
 func (logger *Logger) Errorln(msgs ...interface{}) {
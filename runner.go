@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Number of hooks allowed to run at the same time
+// Configured as boolean or number, true means one worker per CPU
+type parallelism int
+
+func parseParallelism(value string) (parallelism, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return parallelism(runtime.NumCPU()), nil
+	case "false", "no", "off":
+		return 1, nil
+	}
+
+	workers, err := strconv.Atoi(value)
+	if err != nil || workers < 1 {
+		return 0, fmt.Errorf("invalid parallel value %q", value)
+	}
+	return parallelism(workers), nil
+}
+
+func (p *parallelism) UnmarshalJSON(data []byte) (err error) {
+	*p, err = parseParallelism(strings.Trim(string(data), `"`))
+	return
+}
+
+// Duration configured as string like "1m30s" or number of seconds
+type duration time.Duration
+
+func parseDuration(value string) (duration, error) {
+	invalid := fmt.Errorf("invalid duration %q", value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		// NaN, Inf and negative seconds have no duration
+		nanoseconds := seconds * float64(time.Second)
+		if math.IsNaN(nanoseconds) || nanoseconds < 0 || nanoseconds > math.MaxInt64 {
+			return 0, invalid
+		}
+		return duration(nanoseconds), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, invalid
+	}
+	return duration(d), nil
+}
+
+func (d *duration) UnmarshalJSON(data []byte) (err error) {
+	*d, err = parseDuration(strings.Trim(string(data), `"`))
+	return
+}
+
+// Hook killed because it exceed timeout
+type timeoutError struct {
+	hook    string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.hook, e.timeout)
+}
+
+// Hook waiting to be executed
+type hookJob struct {
+	scope string
+	// hook name referenced by before and after
+	id string
+	// name displayed to user
+	name string
+	path string
+	// zero means no timeout
+	timeout time.Duration
+	// ids of hooks must run after this one
+	before []string
+	// ids of hooks must run before this one
+	after []string
+	// hooks must finish before this one start, resolved by sortJobs
+	deps []*hookJob
+	// glob patterns to filter staged files, hook is skipped if nothing matched
+	include []string
+	exclude []string
+	// staged files passed to hook, resolved before execution
+	files []string
+	// hook fix staged files, its modifications are re-staged
+	fix bool
+}
+
+// Sort hooks so every hook come after its dependencies
+// Hooks without dependency between each other keep their original order
+func sortJobs(jobs []*hookJob) ([]*hookJob, error) {
+	ids := make(map[string][]*hookJob)
+	for _, job := range jobs {
+		ids[job.id] = append(ids[job.id], job)
+		job.deps = nil
+	}
+
+	for _, job := range jobs {
+		for _, id := range job.after {
+			for _, dep := range ids[id] {
+				if dep != job {
+					job.deps = append(job.deps, dep)
+				}
+			}
+		}
+		for _, id := range job.before {
+			for _, next := range ids[id] {
+				if next != job {
+					next.deps = append(next.deps, job)
+				}
+			}
+		}
+	}
+
+	sorted := make([]*hookJob, 0, len(jobs))
+	done := make(map[*hookJob]bool)
+	for len(sorted) < len(jobs) {
+		// pick the first hook whose dependencies are all done
+		var ready *hookJob
+		for _, job := range jobs {
+			if done[job] {
+				continue
+			}
+
+			ready = job
+			for _, dep := range job.deps {
+				if !done[dep] {
+					ready = nil
+					break
+				}
+			}
+			if ready != nil {
+				break
+			}
+		}
+
+		if ready == nil {
+			names := make([]string, 0)
+			for _, job := range jobs {
+				if !done[job] {
+					names = append(names, job.name)
+				}
+			}
+			return nil, fmt.Errorf("circular dependency between hooks %s", strings.Join(names, ", "))
+		}
+
+		sorted = append(sorted, ready)
+		done[ready] = true
+	}
+	return sorted, nil
+}
+
+// Execution result of a hook
+type hookResult struct {
+	job      *hookJob
+	status   int
+	err      error
+	duration time.Duration
+	// reason hook not executed, empty if executed
+	skipped string
+	// captured stdout and stderr in parallel mode
+	output []byte
+}
+
+// Execute hooks of a single trigger
+type runner struct {
+	trigger string
+	args    []string
+	// stdin of trigger, replayed to every hook
+	input []byte
+	// single hook talks to git through stdin and stdout, see PROTOCOL_TRIGGERS
+	passThrough bool
+	// hooks of protocol trigger, run together once all scopes are listed
+	pending []*hookJob
+	// worker limit, hooks run one after another if less than 2
+	parallel parallelism
+	// default timeout of hooks
+	timeout time.Duration
+	// root of work tree, staged files are relative to it
+	root string
+	// files in index, nil if unavailable or trigger has no staged files
+	staged []string
+	// re-stage files modified by fix hooks, otherwise fail with diff
+	autoStage bool
+	// skip hooks passed before, nil if disabled
+	cache *hookCache
+	// tree of index for cache keys, computed once and after fix hooks re-stage files
+	tree string
+	// hooks skipped by environment variable for this run
+	skips []string
+	// hooks disabled in this repo
+	disabled []string
+	// run every hook even after failure, summarize at the end
+	keepGoing bool
+	// never clone or update contrib repos, missing repos are errors
+	offline bool
+	// whether git-hooks is interrupted, nil if signals are not captured
+	interrupt func() bool
+	// whether any hook failed
+	failed bool
+	// hooks failed, or skipped because their dependencies failed
+	broken map[*hookJob]bool
+	// results of executed hooks
+	results []*hookResult
+}
+
+func newRunner(configs map[string]string, trigger string, input []byte, args ...string) *runner {
+	root, _ := getGitRepoRoot()
+	passThrough := contains(PROTOCOL_TRIGGERS[:], trigger)
+	// reply of protocol trigger changes without index changing
+	var cache *hookCache
+	if !passThrough {
+		cache = getCache(configs, trigger)
+	}
+	tree := ""
+	if cache != nil {
+		tree = getIndexTree()
+	}
+	// after commit index equals HEAD, nothing is staged for pre-push and alike
+	var staged []string
+	if contains(STAGED_TRIGGERS[:], trigger) {
+		staged = getStagedFiles()
+	}
+	return &runner{
+		trigger:     trigger,
+		args:        args,
+		input:       input,
+		passThrough: passThrough,
+		parallel:    getParallel(configs, trigger),
+		timeout:     getTimeout(),
+		keepGoing:   getKeepGoing(configs, trigger),
+		root:        root,
+		staged:      staged,
+		autoStage:   getAutoStage(),
+		cache:       cache,
+		tree:        tree,
+		skips:       getSkippedHooks(),
+		disabled:    getDisabledHooks(),
+		offline:     getOffline(),
+		broken:      make(map[*hookJob]bool),
+	}
+}
+
+// List options of trigger in config files
+// Project scope come first, then user and global scope
+func triggerConfigs(configs map[string]string, trigger string) []*triggerConfig {
+	options := make([]*triggerConfig, 0)
+	for _, scope := range []string{"project", "user", "global"} {
+		config, ok := configs[scope]
+		if !ok {
+			continue
+		}
+
+		structure, err := listHooksInConfig(config)
+		if err != nil {
+			continue
+		}
+
+		if option, ok := structure[trigger]; ok {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// Find worker limit of trigger
+// Trigger option in config file take precedence over git config hooks.parallel,
+// project scope take precedence over user and global scope
+func getParallel(configs map[string]string, trigger string) parallelism {
+	for _, options := range triggerConfigs(configs, trigger) {
+		if options.Parallel != 0 {
+			return options.Parallel
+		}
+	}
+
+	value, err := gitExec("config --get hooks.parallel")
+	if err != nil {
+		return 1
+	}
+
+	parallel, err := parseParallelism(value)
+	if err != nil {
+		logger.Warnln(err)
+		return 1
+	}
+	return parallel
+}
+
+// Find default timeout of hooks by git config hooks.timeout
+func getTimeout() time.Duration {
+	value, err := gitExec("config --get hooks.timeout")
+	if err != nil {
+		return 0
+	}
+
+	timeout, err := parseDuration(value)
+	if err != nil {
+		logger.Warnln(err)
+		return 0
+	}
+	return time.Duration(timeout)
+}
+
+// Find boolean option of trigger
+// Trigger option in config file take precedence over git config hooks.<name>,
+// disabled if neither configured
+func getFlag(configs map[string]string, trigger, name string, option func(*triggerConfig) *bool) bool {
+	for _, options := range triggerConfigs(configs, trigger) {
+		if value := option(options); value != nil {
+			return *value
+		}
+	}
+
+	value, err := gitExec("config --bool --get hooks." + name)
+	return err == nil && value == "true"
+}
+
+// Whether keep running hooks after failure, fail fast by default
+func getKeepGoing(configs map[string]string, trigger string) bool {
+	return getFlag(configs, trigger, "keepgoing", func(options *triggerConfig) *bool {
+		return options.KeepGoing
+	})
+}
+
+// Whether re-stage files modified by fix hooks by git config hooks.autostage,
+// enabled by default
+func getAutoStage() bool {
+	value, err := gitExec("config --bool --get hooks.autostage")
+	return err != nil || value == "true"
+}
+
+// Whether stash unstaged and untracked changes while pre-commit hooks run
+func getStash(configs map[string]string, trigger string) bool {
+	return trigger == "pre-commit" && getFlag(configs, trigger, "stash", func(options *triggerConfig) *bool {
+		return options.Stash
+	})
+}
+
+// Execute hooks, stop at the first failure unless in keep going mode
+func (r *runner) execute(jobs []*hookJob) {
+	// fail fast
+	if (r.failed && !r.keepGoing) || r.interrupted() {
+		return
+	}
+
+	jobs = r.filter(jobs)
+	if r.passThrough {
+		r.pending = append(r.pending, jobs...)
+		return
+	}
+	if r.parallel < 2 || len(jobs) < 2 {
+		r.executeSequential(jobs)
+	} else {
+		r.executeParallel(jobs)
+	}
+}
+
+// Run the only hook of protocol trigger, replies of several hooks can't be combined
+// Fail without running any if more than one hook is found
+func (r *runner) executePassThrough() {
+	jobs := r.pending
+	r.pending = nil
+	if len(jobs) > 1 {
+		names := make([]string, 0, len(jobs))
+		for _, job := range jobs {
+			names = append(names, job.name)
+		}
+		logger.Errorln(fmt.Sprintf("%s talks to git through stdin and stdout, only one hook can run for it: %s",
+			r.trigger, escapeColor(strings.Join(names, ", "))))
+		return
+	}
+	r.executeSequential(jobs)
+}
+
+// Resolve staged files of each hook,
+// record hooks not need to run as skipped and leave them out
+func (r *runner) filter(jobs []*hookJob) []*hookJob {
+	filtered := make([]*hookJob, 0, len(jobs))
+	for _, job := range jobs {
+		if matchHook(r.skips, r.trigger, job) {
+			r.skip(job, "skipped by "+ENV_SKIP)
+			continue
+		}
+		if isDisabled(r.disabled, r.trigger, job.id) {
+			r.skip(job, "disabled")
+			continue
+		}
+
+		// file patterns only apply to triggers with staged files
+		job.files = r.staged
+		if r.staged != nil && (len(job.include) != 0 || len(job.exclude) != 0) {
+			job.files = filterFiles(r.staged, job.include, job.exclude)
+			if len(job.files) == 0 {
+				r.skip(job, "no matching files")
+				continue
+			}
+		}
+		filtered = append(filtered, job)
+	}
+	return filtered
+}
+
+// Record hook as skipped
+func (r *runner) skip(job *hookJob, reason string) {
+	result := &hookResult{job: job, skipped: reason}
+	logger.Infoln(result.skipMessage())
+	r.results = append(r.results, result)
+}
+
+func (result *hookResult) skipMessage() string {
+	return "Skip " + escapeColor(result.job.name) + ", " + result.skipped
+}
+
+// Dependency of hook failed, hook never start after it
+func (r *runner) brokenDep(job *hookJob) *hookJob {
+	for _, dep := range job.deps {
+		if r.broken[dep] {
+			return dep
+		}
+	}
+	return nil
+}
+
+// Whether signal is received since hooks started, no more hook should start
+func (r *runner) interrupted() bool {
+	return r.interrupt != nil && r.interrupt()
+}
+
+func (r *runner) executeSequential(jobs []*hookJob) {
+	for index, job := range jobs {
+		// signal only kills the running hook, even in keep going mode
+		if r.interrupted() {
+			for _, rest := range jobs[index:] {
+				r.skip(rest, "interrupted")
+			}
+			return
+		}
+		if dep := r.brokenDep(job); dep != nil {
+			r.broken[job] = true
+			r.skip(job, "dependency "+dep.name+" failed")
+			continue
+		}
+
+		result := r.runJob(job, os.Stdout, os.Stderr)
+		r.results = append(r.results, result)
+		if result.skipped != "" {
+			logger.Infoln(result.skipMessage())
+			continue
+		}
+		if result.err == nil {
+			continue
+		}
+
+		r.failed = true
+		r.broken[job] = true
+		if !r.keepGoing {
+			logger.Errorsln(result.status, result.err)
+			return
+		}
+		logger.Warnln(escapeColor(job.name)+" failed: ", result.err)
+	}
+}
+
+// Execute hooks concurrently with at most r.parallel workers
+// A hook only start after its dependencies finished
+// Output of each hook is captured and printed as one block once it finished
+func (r *runner) executeParallel(jobs []*hookJob) {
+	results := make([]*hookResult, len(jobs))
+	positions := make(map[*hookJob]int)
+	for index, job := range jobs {
+		positions[job] = index
+	}
+
+	// number of unfinished dependencies of each hook
+	waiting := make([]int, len(jobs))
+	dependents := make([][]int, len(jobs))
+	for index, job := range jobs {
+		for _, dep := range job.deps {
+			if position, ok := positions[dep]; ok {
+				waiting[index]++
+				dependents[position] = append(dependents[position], index)
+			}
+		}
+	}
+
+	queue := make(chan int, len(jobs))
+	finished := make(chan int)
+	// closed at the first failure in fail fast mode or once interrupted,
+	// hooks queued but not started yet are left out
+	stop := make(chan struct{})
+	var once sync.Once
+	// fix hooks modify files, run them exclusively
+	var lock sync.RWMutex
+	for i := 0; i < int(r.parallel) && i < len(jobs); i++ {
+		go func() {
+			for index := range queue {
+				if r.interrupted() {
+					once.Do(func() { close(stop) })
+				}
+				select {
+				case <-stop:
+					finished <- index
+					continue
+				default:
+				}
+
+				var output bytes.Buffer
+				if jobs[index].fix {
+					lock.Lock()
+				} else {
+					lock.RLock()
+				}
+
+				result := r.runJob(jobs[index], &output, &output)
+
+				if jobs[index].fix {
+					lock.Unlock()
+				} else {
+					lock.RUnlock()
+				}
+
+				result.output = output.Bytes()
+				results[index] = result
+				if result.err != nil && !r.keepGoing {
+					once.Do(func() { close(stop) })
+				}
+				finished <- index
+			}
+		}()
+	}
+
+	running := 0
+	for index := range jobs {
+		if waiting[index] == 0 {
+			queue <- index
+			running++
+		}
+	}
+	// fail fast, stop queueing after the first failure,
+	// hooks already started are left to finish
+	stopped := false
+	for running > 0 {
+		index := <-finished
+		running--
+		stopped = stopped || r.interrupted()
+		if results[index] == nil {
+			continue
+		}
+		r.report(results[index])
+		if results[index].err != nil {
+			r.broken[jobs[index]] = true
+			stopped = stopped || !r.keepGoing
+		}
+
+		for _, next := range dependents[index] {
+			waiting[next]--
+			if waiting[next] == 0 && !stopped && r.brokenDep(jobs[next]) == nil {
+				queue <- next
+				running++
+			}
+		}
+	}
+	close(queue)
+
+	// record hooks never started as skipped,
+	// jobs are sorted so dependencies are resolved first
+	for index, job := range jobs {
+		if results[index] != nil {
+			continue
+		}
+		result := &hookResult{job: job, skipped: "stopped after failure"}
+		if r.interrupted() {
+			result.skipped = "interrupted"
+		}
+		if dep := r.brokenDep(job); dep != nil {
+			r.broken[job] = true
+			result.skipped = "dependency " + dep.name + " failed"
+		}
+		results[index] = result
+		r.report(result)
+	}
+
+	var failure *hookResult
+	for _, result := range results {
+		r.results = append(r.results, result)
+		if result.err != nil && failure == nil {
+			failure = result
+		}
+	}
+
+	// exit with status of the first failed hook
+	if failure != nil {
+		r.failed = true
+		if !r.keepGoing {
+			logger.Errorsln(failure.status, failure.err)
+		}
+	}
+}
+
+func (r *runner) runJob(job *hookJob, stdout, stderr io.Writer) *hookResult {
+	// skip hook passed before with the same index
+	key := ""
+	if r.cache != nil {
+		key = r.cache.key(job, r.args, r.tree)
+		if key != "" && r.cache.has(key) {
+			return &hookResult{job: job, skipped: "passed before"}
+		}
+	}
+
+	start := time.Now()
+	cmd := r.command(job, stdout, stderr)
+
+	// expose staged files through environment and NUL separated file
+	if job.files != nil {
+		list, err := writeFileList(job.files)
+		if err != nil {
+			logger.Warnln("Fail to write staged files ", err)
+		} else {
+			defer os.Remove(list)
+			cmd.Env = append(os.Environ(), ENV_STAGED_FILE_LIST+"="+list)
+			// single environment variable is limited to 128KB on linux
+			if files := strings.Join(job.files, "\n"); len(files) < 64*1024 {
+				cmd.Env = append(cmd.Env, ENV_STAGED_FILES+"="+files)
+			}
+		}
+	}
+
+	var fix *fixup
+	if job.fix && len(job.files) != 0 {
+		fix = r.prepareFix(job)
+	}
+
+	status, err := runHook(cmd, job.timeout)
+	// edits of crashed or killed hook may be partial, never stage them
+	if fix != nil && err == nil {
+		if fixErr := fix.apply(stdout); fixErr != nil {
+			status, err = 1, fixErr
+		}
+	}
+
+	// fix hook may change index, only cache if it pass on unchanged index
+	// Fix hooks run exclusively, no other hook is using the index meanwhile
+	unchanged := true
+	if r.cache != nil && job.fix {
+		tree := getIndexTree()
+		unchanged = tree == r.tree
+		r.tree = tree
+	}
+	if key != "" && err == nil && unchanged {
+		r.cache.add(key)
+	}
+
+	return &hookResult{
+		job:      job,
+		status:   status,
+		err:      err,
+		duration: time.Since(start),
+	}
+}
+
+// Print summary in keep going mode, exit with status of the first failed hook
+func (r *runner) finish() {
+	if !r.keepGoing || len(r.results) == 0 {
+		return
+	}
+
+	r.summary()
+
+	var failure *hookResult
+	failed := 0
+	for _, result := range r.results {
+		if result.err != nil {
+			failed++
+			if failure == nil {
+				failure = result
+			}
+		}
+	}
+
+	if failure != nil {
+		logger.Errorsln(failure.status, fmt.Sprintf("%d of %d hooks failed", failed, len(r.results)))
+	}
+}
+
+// Print table of executed hooks with scope, status and duration
+func (r *runner) summary() {
+	var table bytes.Buffer
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SCOPE\tHOOK\tSTATUS\tDURATION")
+	for _, result := range r.results {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			result.job.scope, result.job.name, result.describe(), result.duration.Round(time.Millisecond))
+	}
+	writer.Flush()
+
+	logger.Infoln()
+	logger.Info(escapeColor(table.String()))
+}
+
+// Short description of hook status
+func (result *hookResult) describe() string {
+	if result.skipped != "" {
+		return "skipped"
+	}
+	if result.err == nil {
+		return "ok"
+	}
+	if _, ok := result.err.(*timeoutError); ok {
+		return "timeout"
+	}
+	return fmt.Sprintf("exit %d", result.status)
+}
+
+// Print captured output of hook as one block
+func (r *runner) report(result *hookResult) {
+	if result.skipped != "" {
+		logger.Infoln(result.skipMessage())
+		return
+	}
+
+	logger.Infoln("==> " + escapeColor(result.job.name))
+	os.Stdout.Write(result.output)
+	if result.err != nil {
+		logger.Warnln(escapeColor(result.job.name)+" failed: ", result.err)
+	}
+}
+
+func (r *runner) command(job *hookJob, stdout, stderr io.Writer) *exec.Cmd {
+	cmd := exec.Command(job.path, r.args...)
+	if r.passThrough {
+		cmd.Stdin = os.Stdin
+	} else if r.input != nil {
+		cmd.Stdin = bytes.NewReader(r.input)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Hook wait for its peer to start, only succeed if both run concurrently
+func waitFor(peer string) string {
+	return `touch "$(basename "$0").started"
+for i in $(seq 50); do
+  [ -f "` + peer + `.started" ] && exit 0
+  sleep 0.1
+done
+exit 1
+`
+}
+
+func TestParseParallelism(t *testing.T) {
+	parallel, err := parseParallelism("true")
+	assert.Nil(t, err)
+	assert.Equal(t, parallelism(runtime.NumCPU()), parallel)
+
+	parallel, err = parseParallelism("false")
+	assert.Nil(t, err)
+	assert.Equal(t, parallelism(1), parallel)
+
+	parallel, err = parseParallelism("4")
+	assert.Nil(t, err)
+	assert.Equal(t, parallelism(4), parallel)
+
+	_, err = parseParallelism("0")
+	assert.NotNil(t, err)
+
+	_, err = parseParallelism("many")
+	assert.NotNil(t, err)
+}
+
+func TestRunParallel(t *testing.T) {
+	// sequential by default
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", `[ -f second.started ]`)
+		createHook(t, "githooks", "pre-commit", "second", `touch second.started`)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		assert.Equal(t, parallelism(1), r.parallel)
+
+		runDirHooks(r, hookDirs())
+		assert.True(t, r.failed)
+		logger.clear()
+	})
+
+	// enable by git config
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", waitFor("second"))
+		createHook(t, "githooks", "pre-commit", "second", waitFor("first"))
+		err := exec.Command("git", "config", "hooks.parallel", "2").Run()
+		assert.Nil(t, err)
+
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 0, len(logger.errors))
+		// one output block per hook
+		assert.Contains(t, logger.infos, "==> pre-commit/first")
+		assert.Contains(t, logger.infos, "==> pre-commit/second")
+		logger.clear()
+	})
+
+	// enable by trigger option in config file
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", waitFor("second"))
+		createHook(t, "githooks", "pre-commit", "second", waitFor("first"))
+		err := ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"parallel": true}}`), 0644)
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		assert.Equal(t, parallelism(runtime.NumCPU()), r.parallel)
+		logger.clear()
+	})
+
+	// aggregate status, every hook runs even if one failed in keep going mode
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", `exit 3`)
+		createHook(t, "githooks", "pre-commit", "second", `touch second.out`)
+		err := exec.Command("git", "config", "hooks.parallel", "2").Run()
+		assert.Nil(t, err)
+		err = exec.Command("git", "config", "hooks.keepgoing", "true").Run()
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runDirHooks(r, hookDirs())
+		assert.True(t, r.failed)
+		r.finish()
+		assert.True(t, len(logger.errors) != 0)
+
+		isExist, _ := exists("second.out")
+		assert.True(t, isExist)
+		logger.clear()
+	})
+}
+
+func TestParseDuration(t *testing.T) {
+	d, err := parseDuration("1m30s")
+	assert.Nil(t, err)
+	assert.Equal(t, duration(90*time.Second), d)
+
+	d, err = parseDuration("2.5")
+	assert.Nil(t, err)
+	assert.Equal(t, duration(2500*time.Millisecond), d)
+
+	_, err = parseDuration("soon")
+	assert.NotNil(t, err)
+
+	for _, value := range []string{"-5", "-1s", "NaN", "Inf", "-Inf", "1e300"} {
+		_, err = parseDuration(value)
+		assert.Equal(t, fmt.Sprintf("invalid duration %q", value), fmt.Sprint(err))
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	createDirectory(t, os.TempDir(), func(tempdir string) {
+		// hook spawn a child process and hang
+		createHook(t, tempdir, "pre-commit", "hang", `sleep 30 &
+echo $! > child.pid
+wait`)
+
+		cmd := exec.Command(filepath.Join(tempdir, "pre-commit", "hang"))
+		start := time.Now()
+		status, err := runHook(cmd, 300*time.Millisecond)
+		assert.True(t, time.Since(start) < time.Second)
+		assert.Equal(t, 124, status)
+		_, ok := err.(*timeoutError)
+		assert.True(t, ok)
+
+		// child process killed along with hook
+		pid, err := ioutil.ReadFile("child.pid")
+		assert.Nil(t, err)
+		assert.True(t, waitExited(strings.TrimSpace(string(pid)), 5*time.Second))
+
+		// finish in time
+		createHook(t, tempdir, "pre-commit", "quick", `exit 2`)
+		status, err = runHook(exec.Command(filepath.Join(tempdir, "pre-commit", "quick")), time.Minute)
+		assert.Equal(t, 2, status)
+		_, ok = err.(*timeoutError)
+		assert.False(t, ok)
+	})
+}
+
+// Wait until process is gone or left as zombie not reaped by its killed parent
+func waitExited(pid string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		out, err := exec.Command("ps", "-o", "stat=", "-p", pid).Output()
+		if err != nil || strings.HasPrefix(strings.TrimSpace(string(out)), "Z") {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestRunTimeout(t *testing.T) {
+	// default timeout by git config
+	createGitRepo(t, func(tempdir string) {
+		err := exec.Command("git", "config", "hooks.timeout", "300ms").Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "hang", `sleep 30`)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		assert.Equal(t, 300*time.Millisecond, r.timeout)
+
+		runDirHooks(r, hookDirs())
+		assert.True(t, r.failed)
+		_, ok := logger.errors[0].(*timeoutError)
+		assert.True(t, ok)
+		logger.clear()
+	})
+
+	// per hook timeout in config file
+	createGitRepo(t, func(tempdir string) {
+		err := ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/git-hooks/contrib": ["golint", {"name": "whitespace", "timeout": "5s"}]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		config, err := listHooksInConfig("githooks.json")
+		assert.Nil(t, err)
+		hooks := config["pre-commit"].Repos[0].Hooks
+		assert.Equal(t, "golint", hooks[0].Name)
+		assert.Equal(t, duration(0), hooks[0].Timeout)
+		assert.Equal(t, "whitespace", hooks[1].Name)
+		assert.Equal(t, duration(5*time.Second), hooks[1].Timeout)
+	})
+
+	// invalid option fail the run instead of turning off hooks of trigger
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "touch", `touch run.out`)
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"`+filepath.Join(wd, "local")+`": [{"name": "lint", "timeout": "soon"}]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		_, err = listHooksInConfig("githooks.json")
+		assert.Equal(t, `githooks.json: invalid duration "soon"`, err.Error())
+
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, filepath.Join(wd, "githooks.json")+`: invalid duration "soon"`, logger.errors[0])
+		isExist, _ := exists("run.out")
+		assert.False(t, isExist)
+		logger.clear()
+
+		for _, command := range []func(){list, lock, fetch, autoupdate} {
+			command()
+			assert.Equal(t, filepath.Join(wd, "githooks.json")+`: invalid duration "soon"`, logger.errors[0])
+			logger.clear()
+		}
+	})
+}
+
+func TestRunKeepGoing(t *testing.T) {
+	// fail fast by default
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", `exit 3`)
+		createHook(t, "githooks", "pre-commit", "second", `touch second.out`)
+
+		runTrusted(t, "pre-commit")
+		assert.True(t, len(logger.errors) != 0)
+		isExist, _ := exists("second.out")
+		assert.False(t, isExist)
+		logger.clear()
+	})
+
+	// keep going by git config
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, "githooks", "pre-commit", "first", `exit 3`)
+		createHook(t, "githooks", "pre-commit", "second", `touch second.out`)
+		createHook(t, "githooks", "pre-commit", "third", `exit 4`)
+		err := exec.Command("git", "config", "hooks.keepgoing", "yes").Run()
+		assert.Nil(t, err)
+
+		runTrusted(t, "pre-commit")
+		isExist, _ := exists("second.out")
+		assert.True(t, isExist)
+		assert.Equal(t, "2 of 3 hooks failed", logger.errors[0])
+
+		summary := logger.infos[len(logger.infos)-1].(string)
+		assert.Contains(t, summary, "SCOPE")
+		assert.Contains(t, summary, "pre-commit/first")
+		assert.Contains(t, summary, "exit 3")
+		assert.Contains(t, summary, "pre-commit/second")
+		assert.Contains(t, summary, "ok")
+		assert.Contains(t, summary, "exit 4")
+		logger.clear()
+	})
+
+	// trigger option in config file take precedence
+	createGitRepo(t, func(tempdir string) {
+		err := exec.Command("git", "config", "hooks.keepgoing", "true").Run()
+		assert.Nil(t, err)
+		err = ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"keepgoing": false}}`), 0644)
+		assert.Nil(t, err)
+
+		assert.False(t, getKeepGoing(hookConfigs(), "pre-commit"))
+		assert.True(t, getKeepGoing(hookConfigs(), "commit-msg"))
+	})
+}
+
+func TestSortJobs(t *testing.T) {
+	names := func(jobs []*hookJob) []string {
+		result := make([]string, 0)
+		for _, job := range jobs {
+			result = append(result, job.id)
+		}
+		return result
+	}
+
+	// keep original order without dependencies
+	jobs, err := sortJobs([]*hookJob{{id: "b"}, {id: "a"}, {id: "c"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "a", "c"}, names(jobs))
+
+	// before and after
+	jobs, err = sortJobs([]*hookJob{
+		{id: "golint", after: []string{"goimports"}},
+		{id: "whitespace"},
+		{id: "gofmt", before: []string{"golint", "goimports"}},
+		{id: "goimports"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"whitespace", "gofmt", "goimports", "golint"}, names(jobs))
+
+	// unknown hook is ignored
+	jobs, err = sortJobs([]*hookJob{{id: "a", after: []string{"missing"}}, {id: "b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, names(jobs))
+
+	// circular dependency
+	_, err = sortJobs([]*hookJob{
+		{id: "a", after: []string{"b"}},
+		{id: "b", after: []string{"a"}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestRunOrder(t *testing.T) {
+	// global, user, then project scope, alphabetical inside scope
+	createGitRepo(t, func(tempdir string) {
+		global := filepath.Join(tempdir, "global")
+		createHook(t, global, "pre-commit", "z", `echo global-z >> order.out`)
+		createHook(t, "githooks", "pre-commit", "b", `echo b >> order.out`)
+		createHook(t, "githooks", "pre-commit", "a", `echo a >> order.out`)
+		createHook(t, "githooks", "_pre-commit", "c", `echo _c >> order.out`)
+		err := exec.Command("git", "config", "hooks.global", global).Run()
+		assert.Nil(t, err)
+
+		for i := 0; i < 3; i++ {
+			os.Remove("order.out")
+			runTrusted(t, "pre-commit")
+			out, err := ioutil.ReadFile("order.out")
+			assert.Nil(t, err)
+			assert.Equal(t, "global-z\n_c\na\nb\n", string(out))
+		}
+		logger.clear()
+	})
+
+	// repos and hooks in declaration order of config file
+	createGitRepo(t, func(tempdir string) {
+		err := ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"parallel": 2,
+				"github.com/org/zeta": ["lint", {"name": "fmt", "before": ["lint"]}],
+				"github.com/org/alpha": ["test"]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		config, err := listHooksInConfig("githooks.json")
+		assert.Nil(t, err)
+		repos := config["pre-commit"].Repos
+		assert.Equal(t, 2, len(repos))
+		assert.Equal(t, "github.com/org/zeta", repos[0].Name)
+		assert.Equal(t, "lint", repos[0].Hooks[0].Name)
+		assert.Equal(t, "fmt", repos[0].Hooks[1].Name)
+		assert.Equal(t, []string{"lint"}, repos[0].Hooks[1].Before)
+		assert.Equal(t, "github.com/org/alpha", repos[1].Name)
+	})
+}
+
+func TestRunParallelDependency(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		createHook(t, tempdir, "pre-commit", "fmt", `sleep 0.3; touch fmt.done`)
+		createHook(t, tempdir, "pre-commit", "lint", `[ -f fmt.done ]`)
+		createHook(t, tempdir, "pre-commit", "test", `true`)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		r.parallel = 3
+		jobs, err := sortJobs([]*hookJob{
+			{id: "lint", name: "lint", path: filepath.Join(tempdir, "pre-commit", "lint"), after: []string{"fmt"}},
+			{id: "fmt", name: "fmt", path: filepath.Join(tempdir, "pre-commit", "fmt")},
+			{id: "test", name: "test", path: filepath.Join(tempdir, "pre-commit", "test")},
+		})
+		assert.Nil(t, err)
+
+		r.execute(jobs)
+		assert.False(t, r.failed)
+		assert.Equal(t, 3, len(r.results))
+		logger.clear()
+	})
+}
+
+func TestRunParallelFailure(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		// slow already started when fmt fail
+		createHook(t, tempdir, "pre-commit", "fmt", `sleep 0.2; exit 3`)
+		createHook(t, tempdir, "pre-commit", "lint", `touch lint.out`)
+		createHook(t, tempdir, "pre-commit", "slow", `sleep 0.5; touch slow.out`)
+		createHook(t, tempdir, "pre-commit", "test", `touch test.out`)
+		createHook(t, tempdir, "pre-commit", "vet", `touch vet.out`)
+		jobs := func() []*hookJob {
+			job := func(id string, after ...string) *hookJob {
+				return &hookJob{id: id, name: id, path: filepath.Join(tempdir, "pre-commit", id), after: after}
+			}
+			jobs, err := sortJobs([]*hookJob{job("fmt"), job("slow"), job("lint", "fmt"), job("test"), job("vet")})
+			assert.Nil(t, err)
+			return jobs
+		}
+		skipped := func(r *runner) map[string]string {
+			reasons := make(map[string]string)
+			for _, result := range r.results {
+				if result.skipped != "" {
+					reasons[result.job.id] = result.skipped
+				}
+			}
+			return reasons
+		}
+
+		// fail fast, hooks started before failure finish, others never start
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		r.parallel = 2
+		r.execute(jobs())
+		assert.True(t, r.failed)
+		assert.Equal(t, 5, len(r.results))
+		assert.Equal(t, map[string]string{
+			"lint": "dependency fmt failed",
+			"test": "stopped after failure",
+			"vet":  "stopped after failure",
+		}, skipped(r))
+		for _, name := range []string{"lint.out", "test.out", "vet.out"} {
+			isExist, _ := exists(name)
+			assert.False(t, isExist, name)
+		}
+		isExist, _ := exists("slow.out")
+		assert.True(t, isExist)
+		logger.clear()
+
+		// keep going, only dependents of failed hook are skipped
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		r.parallel = 2
+		r.keepGoing = true
+		r.execute(jobs())
+		assert.Equal(t, map[string]string{"lint": "dependency fmt failed"}, skipped(r))
+		for _, name := range []string{"test.out", "vet.out"} {
+			isExist, _ := exists(name)
+			assert.True(t, isExist, name)
+		}
+		isExist, _ = exists("lint.out")
+		assert.False(t, isExist)
+		logger.clear()
+
+		// sequential
+		r = newRunner(hookConfigs(), "pre-commit", nil)
+		r.keepGoing = true
+		r.execute(jobs())
+		assert.Equal(t, map[string]string{"lint": "dependency fmt failed"}, skipped(r))
+		isExist, _ = exists("lint.out")
+		assert.False(t, isExist)
+		logger.clear()
+	})
+}
+
+func TestRunStagedFiles(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		mkdir -p vendor/lib;
+		touch main.go run.sh "with space.go" vendor/lib/lib.go unstaged.go;
+		git add main.go run.sh "with space.go" vendor/lib/lib.go;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+
+		contrib := filepath.Join(tempdir, "contrib")
+		repo := filepath.Join(contrib, "github.com", "org", "hooks")
+		createHook(t, repo, "", "golint", `echo "$GIT_HOOKS_STAGED_FILES" > golint.out; tr '\0' '\n' < "$GIT_HOOKS_STAGED_FILE_LIST" > golint.list`)
+		createHook(t, repo, "", "pylint", `touch pylint.out`)
+		createHook(t, repo, "", "whitespace", `echo "$GIT_HOOKS_STAGED_FILES" > whitespace.out`)
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {
+				"github.com/org/hooks": [
+					{"name": "golint", "files": ["*.go"], "exclude": ["vendor/**"]},
+					{"name": "pylint", "files": ["*.py"]},
+					"whitespace"
+				]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+
+		out, err := ioutil.ReadFile("golint.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "main.go\nwith space.go\n", string(out))
+
+		out, err = ioutil.ReadFile("golint.list")
+		assert.Nil(t, err)
+		assert.Equal(t, "main.go\nwith space.go\n", string(out))
+
+		// skipped without matching files
+		isExist, _ := exists("pylint.out")
+		assert.False(t, isExist)
+		assert.Equal(t, "no matching files", r.results[0].skipped)
+
+		// every staged file without filter
+		out, err = ioutil.ReadFile("whitespace.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "main.go\nrun.sh\nvendor/lib/lib.go\nwith space.go\n", string(out))
+		logger.clear()
+
+		// nothing staged after commit, file patterns don't apply
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"post-commit": {
+				"github.com/org/hooks": [{"name": "pylint", "files": ["*.py"]}]
+			}
+		}`), 0644)
+		assert.Nil(t, err)
+		r = newRunner(hookConfigs(), "post-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.False(t, r.failed)
+		isExist, _ = exists("pylint.out")
+		assert.True(t, isExist)
+		logger.clear()
+	})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Unstaged and untracked changes set aside while pre-commit hooks run,
+// so hooks see exactly what is going to be committed
+// Changes are kept under git dir, a run interrupted before restore
+// is recovered by the next run
+type stash struct {
+	// root of work tree
+	root string
+	dir  string
+	// signals received while changes are stashed
+	signals chan os.Signal
+	// whether any signal is received, it stays once taken from signals
+	caught bool
+	// hook workers check interrupt concurrently
+	lock sync.Mutex
+}
+
+func getStashDir() (string, error) {
+	gitDir, err := getAbsGitDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, STASH_DIRNAME), nil
+}
+
+// Changes stashed by an interrupted run, nil if there are none
+// Stash of git-hooks running the current one, like a pre-commit hook
+// calling git commands which trigger hooks, is not leftover
+// Checked by every run, stash directory is looked up first as it's rarely there
+func leftoverStash() (*stash, error) {
+	dir, err := getStashDir()
+	if err != nil {
+		return nil, err
+	}
+
+	isExist, _ := exists(dir)
+	if !isExist || os.Getenv(ENV_STASH) == dir {
+		return nil, nil
+	}
+
+	root, err := getGitRepoRoot()
+	if err != nil {
+		// no work tree, nothing to stash
+		return nil, nil
+	}
+	return &stash{root: root, dir: dir}, nil
+}
+
+// Restore changes left by interrupted run, whatever trigger is run
+func recoverStash() error {
+	s, err := leftoverStash()
+	if err != nil || s == nil {
+		return err
+	}
+
+	logger.Warnln(MESSAGES["RecoverStash"])
+	return s.restore()
+}
+
+// Stash unstaged changes of tracked files and untracked files
+// Nothing is stashed if git-hooks running the current one stashed them
+func stashChanges() (*stash, error) {
+	if err := recoverStash(); err != nil {
+		return nil, err
+	}
+
+	root, err := getGitRepoRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := getStashDir()
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv(ENV_STASH) == dir {
+		return nil, nil
+	}
+
+	s := &stash{
+		root: root,
+		dir:  dir,
+	}
+
+	if err := os.MkdirAll(s.untracked(), 0755); err != nil {
+		return nil, err
+	}
+	os.Setenv(ENV_STASH, s.dir)
+
+	// restore before exit, even if interrupted or hook failed
+	s.signals = make(chan os.Signal, 1)
+	signal.Notify(s.signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	logger.OnExit(func() {
+		if err := s.restore(); err != nil {
+			logger.Warnln(err)
+		}
+	})
+
+	// unstaged changes of tracked files
+	patch, err := gitExecRaw(root, nil, "diff", "--binary", "--no-color", "--no-ext-diff", "--ignore-submodules")
+	if err != nil {
+		return s, err
+	}
+	if len(patch) != 0 {
+		if err := ioutil.WriteFile(s.patch(), patch, 0644); err != nil {
+			return s, err
+		}
+		if err := s.checkoutIndex(); err != nil {
+			return s, err
+		}
+	}
+
+	// untracked files
+	out, err := gitExecRaw(root, nil, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return s, err
+	}
+	for _, file := range bytes.Split(out, []byte{0}) {
+		if len(file) == 0 {
+			continue
+		}
+		if err := move(filepath.Join(root, string(file)), filepath.Join(s.untracked(), string(file))); err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
+
+// Put stashed changes back to work tree
+// Modifications made by hooks to files with unstaged changes are discarded,
+// unstaged changes are kept as patch if they can't be applied
+func (s *stash) restore() error {
+	if s.signals != nil {
+		signal.Stop(s.signals)
+	}
+	if os.Getenv(ENV_STASH) == s.dir {
+		os.Unsetenv(ENV_STASH)
+	}
+
+	isExist, _ := exists(s.dir)
+	if !isExist {
+		return nil
+	}
+
+	// untracked files
+	err := filepath.Walk(s.untracked(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relpath, err := filepath.Rel(s.untracked(), path)
+		if err != nil {
+			return err
+		}
+		return move(path, filepath.Join(s.root, relpath))
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// unstaged changes
+	isExist, _ = exists(s.patch())
+	if isExist {
+		if _, err := gitExecRaw(s.root, nil, "apply", "--whitespace=nowarn", s.patch()); err != nil {
+			logger.Warnln(MESSAGES["StashConflict"])
+			if err := s.checkoutIndex(); err != nil {
+				return err
+			}
+			if _, err := gitExecRaw(s.root, nil, "apply", "--whitespace=nowarn", s.patch()); err != nil {
+				kept := s.dir + ".patch"
+				os.Rename(s.patch(), kept)
+				os.RemoveAll(s.dir)
+				return errors.New(MESSAGES["StashKept"] + kept)
+			}
+		}
+	}
+
+	return os.RemoveAll(s.dir)
+}
+
+// Whether git-hooks is interrupted while changes are stashed
+func (s *stash) interrupted() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.caught {
+		return true
+	}
+	select {
+	case <-s.signals:
+		s.caught = true
+	default:
+	}
+	return s.caught
+}
+
+func (s *stash) patch() string {
+	return filepath.Join(s.dir, "unstaged.patch")
+}
+
+func (s *stash) untracked() string {
+	return filepath.Join(s.dir, "untracked")
+}
+
+// Reset files differ from index to their staged content
+// Unlike `git checkout`, post-checkout hooks are not triggered
+func (s *stash) checkoutIndex() error {
+	files, err := gitExecRaw(s.root, nil, "diff", "--name-only", "-z", "--ignore-submodules")
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	_, err = gitExecRaw(s.root, files, "checkout-index", "--force", "-z", "--stdin")
+	return err
+}
+
+// Move file, create parent directories of destination
+func move(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dest)
+}
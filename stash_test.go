@@ -0,0 +1,217 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// Create repo with staged, unstaged and untracked changes
+func createDirtyRepo(t *testing.T, context func(tempdir string)) {
+	createGitRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		echo one > a.txt;
+		echo one > b.txt;
+		git add a.txt b.txt;
+		git commit -m "init";
+		echo two > a.txt;
+		git add a.txt;
+		echo three > a.txt;
+		rm b.txt;
+		mkdir -p new;
+		echo untracked > new/u.txt;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+
+		context(tempdir)
+	})
+}
+
+func assertDirty(t *testing.T) {
+	out, err := ioutil.ReadFile("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "three\n", string(out))
+
+	staged, err := gitExec("show :a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "two", staged)
+
+	isExist, _ := exists("b.txt")
+	assert.False(t, isExist)
+
+	out, err = ioutil.ReadFile("new/u.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "untracked\n", string(out))
+}
+
+func TestRunStash(t *testing.T) {
+	// hooks see work tree matching index
+	createDirtyRepo(t, func(tempdir string) {
+		err := exec.Command("git", "config", "hooks.stash", "true").Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "check", `
+		[ "$(cat a.txt)" = two ] || exit 1
+		[ -f b.txt ] || exit 2
+		[ ! -f new/u.txt ] || exit 3`)
+		err = exec.Command("git", "add", "githooks").Run()
+		assert.Nil(t, err)
+
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 0, len(logger.errors))
+		assertDirty(t)
+
+		isExist, _ := exists(".git/" + STASH_DIRNAME)
+		assert.False(t, isExist)
+		logger.clear()
+	})
+
+	// restore after hook failed
+	createDirtyRepo(t, func(tempdir string) {
+		err := ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"stash": true}}`), 0644)
+		assert.Nil(t, err)
+		err = exec.Command("git", "add", "githooks.json").Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "fail", `exit 1`)
+		err = exec.Command("git", "add", "githooks").Run()
+		assert.Nil(t, err)
+
+		runTrusted(t, "pre-commit")
+		assert.True(t, len(logger.errors) != 0)
+		assertDirty(t)
+		logger.clear()
+	})
+
+	// discard modifications of hooks conflict with unstaged changes
+	createDirtyRepo(t, func(tempdir string) {
+		err := exec.Command("git", "config", "hooks.stash", "true").Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "format", `echo formatted > a.txt`)
+		err = exec.Command("git", "add", "githooks").Run()
+		assert.Nil(t, err)
+
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, MESSAGES["StashConflict"], logger.warns[0])
+		assertDirty(t)
+		logger.clear()
+	})
+
+	// stash only around pre-commit
+	createDirtyRepo(t, func(tempdir string) {
+		err := exec.Command("git", "config", "hooks.stash", "true").Run()
+		assert.Nil(t, err)
+		createHook(t, "githooks", "commit-msg", "check", `[ "$(cat a.txt)" = three ]`)
+
+		runTrusted(t, "commit-msg")
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+	})
+}
+
+func TestRunStashInterrupted(t *testing.T) {
+	createDirtyRepo(t, func(tempdir string) {
+		cmd := exec.Command("bash", "-c", `
+		git config hooks.stash true;
+		git config hooks.keepgoing true;
+		`)
+		err := cmd.Run()
+		assert.Nil(t, err)
+		// like Ctrl-C sent to git-hooks while first hook runs
+		createHook(t, "githooks", "pre-commit", "first", `kill -INT $PPID; sleep 0.2`)
+		createHook(t, "githooks", "pre-commit", "second", `touch second.out`)
+		err = exec.Command("git", "add", "githooks").Run()
+		assert.Nil(t, err)
+
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, MESSAGES["Interrupted"], logger.errors[0])
+		assert.Contains(t, logger.infos, "Skip pre-commit/second, interrupted")
+		isExist, _ := exists("second.out")
+		assert.False(t, isExist)
+		assertDirty(t)
+		logger.clear()
+
+		// queued hooks never start
+		_, err = gitExec("config hooks.parallel 2")
+		assert.Nil(t, err)
+		createHook(t, "githooks", "pre-commit", "second", `sleep 0.5`)
+		createHook(t, "githooks", "pre-commit", "third", `touch third.out`)
+		err = exec.Command("git", "add", "githooks").Run()
+		assert.Nil(t, err)
+		runTrusted(t, "pre-commit")
+		assert.Equal(t, MESSAGES["Interrupted"], logger.errors[0])
+		assert.Contains(t, logger.infos, "Skip pre-commit/third, interrupted")
+		isExist, _ = exists("third.out")
+		assert.False(t, isExist)
+		assertDirty(t)
+		logger.clear()
+	})
+}
+
+func TestStashRecover(t *testing.T) {
+	createDirtyRepo(t, func(tempdir string) {
+		// interrupted without restore, environment is gone with the process
+		s, err := stashChanges()
+		assert.Nil(t, err)
+		s.signals = nil
+		os.Unsetenv(ENV_STASH)
+		isExist, _ := exists("new/u.txt")
+		assert.False(t, isExist)
+
+		// next run recover stashed changes before stash again
+		s, err = stashChanges()
+		assert.Nil(t, err)
+		assert.Equal(t, MESSAGES["RecoverStash"], logger.warns[0])
+
+		err = s.restore()
+		assert.Nil(t, err)
+		assertDirty(t)
+		logger.clear()
+	})
+
+	// recovered by run of any trigger, stash turned off
+	createDirtyRepo(t, func(tempdir string) {
+		s, err := stashChanges()
+		assert.Nil(t, err)
+		s.signals = nil
+		os.Unsetenv(ENV_STASH)
+
+		doctor()
+		assert.Contains(t, logger.warns, "[fail] Changes stashed by an interrupted run are hidden in "+s.dir)
+		logger.clear()
+
+		runTrusted(t, "post-commit")
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Equal(t, MESSAGES["RecoverStash"], logger.warns[0])
+		assertDirty(t)
+		isExist, _ := exists(s.dir)
+		assert.False(t, isExist)
+		logger.clear()
+
+		doctor()
+		assert.Contains(t, logger.infos, "[ok]   No changes left stashed")
+		logger.clear()
+	})
+
+	// stash of running git-hooks is left alone by hooks it runs
+	createDirtyRepo(t, func(tempdir string) {
+		s, err := stashChanges()
+		assert.Nil(t, err)
+
+		runTrusted(t, "post-checkout")
+		nested, err := stashChanges()
+		assert.Nil(t, err)
+		assert.Nil(t, nested)
+		assert.Equal(t, 0, len(logger.warns))
+		isExist, _ := exists("new/u.txt")
+		assert.False(t, isExist)
+
+		err = s.restore()
+		assert.Nil(t, err)
+		assertDirty(t)
+		assert.Equal(t, "", os.Getenv(ENV_STASH))
+		logger.clear()
+	})
+}
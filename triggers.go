@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"github.com/blang/semver"
+	"regexp"
+)
+
+// Version of git in PATH, parsed from output like
+// `git version 2.39.5` or `git version 2.24.3 (Apple Git-128)`
+func getGitVersion() (semver.Version, error) {
+	out, err := gitExec("--version")
+	if err != nil {
+		return semver.Version{}, err
+	}
+	return parseGitVersion(out)
+}
+
+func parseGitVersion(out string) (semver.Version, error) {
+	version := regexp.MustCompile(`\d+\.\d+(\.\d+)?`).FindString(out)
+	if version == "" {
+		return semver.Version{}, fmt.Errorf("unknown git version: %s", out)
+	}
+	return semver.ParseTolerant(version)
+}
+
+// Triggers run by git of version
+func triggersOf(version semver.Version) []string {
+	triggers := make([]string, 0)
+	for _, trigger := range TRIGGERS {
+		if since, ok := TRIGGER_VERSIONS[trigger]; ok && version.LT(semver.MustParse(since)) {
+			continue
+		}
+		triggers = append(triggers, trigger)
+	}
+	return triggers
+}
+
+// Triggers run by git in PATH, all triggers if git version is unknown
+func supportedTriggers() []string {
+	version, err := getGitVersion()
+	if err != nil {
+		return TRIGGERS[:]
+	}
+	return triggersOf(version)
+}
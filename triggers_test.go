@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseGitVersion(t *testing.T) {
+	cases := map[string]string{
+		"git version 2.39.5":                 "2.39.5",
+		"git version 2.24.3 (Apple Git-128)": "2.24.3",
+		"git version 2.41.0.windows.1":       "2.41.0",
+		"git version 1.8":                    "1.8.0",
+	}
+	for out, expected := range cases {
+		version, err := parseGitVersion(out)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, version.String())
+	}
+
+	_, err := parseGitVersion("git version unknown")
+	assert.NotNil(t, err)
+}
+
+func TestTriggersOf(t *testing.T) {
+	triggers := triggersOf(semver.MustParse("2.23.0"))
+	assert.Contains(t, triggers, "pre-commit")
+	assert.Contains(t, triggers, "post-rewrite")
+	assert.Contains(t, triggers, "post-index-change")
+	assert.NotContains(t, triggers, "pre-merge-commit")
+	assert.NotContains(t, triggers, "reference-transaction")
+
+	triggers = triggersOf(semver.MustParse("1.8.1"))
+	assert.NotContains(t, triggers, "pre-push")
+
+	assert.Equal(t, len(TRIGGERS), len(triggersOf(semver.MustParse("2.29.0"))))
+
+	// every trigger has a valid version
+	for trigger, since := range TRIGGER_VERSIONS {
+		_, err := semver.Parse(since)
+		assert.Nil(t, err, trigger)
+		assert.Contains(t, TRIGGERS, trigger)
+	}
+}
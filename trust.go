@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Hash of project hooks, githooks directory, githooks.json, githooks.lock
+// and hooks of local repos in githooks.json
+// Symlinks are hashed with their targets, even outside work tree
+// Empty if project has no hook, or repo has no work tree like bare repos
+func getProjectHash() (string, error) {
+	root, err := getGitRepoRoot()
+	if err != nil {
+		if _, gitErr := getGitDirPath(); gitErr == nil {
+			return "", nil
+		}
+		return "", err
+	}
+	// paths of symlink targets are relative to real path of work tree
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	found := false
+	visited := make(map[string]bool)
+	var walk func(dir string) error
+	var write func(path string, info os.FileInfo) error
+	write = func(path string, info os.FileInfo) error {
+		var content []byte
+		var err error
+		isLink := info.Mode()&os.ModeSymlink != 0
+		if isLink {
+			var target string
+			target, err = os.Readlink(path)
+			content = []byte(target)
+		} else {
+			content, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			return err
+		}
+
+		relpath, _ := filepath.Rel(root, path)
+		fmt.Fprintf(hash, "%s\x00%s\x00%x\x00", relpath, info.Mode(), sha256.Sum256(content))
+		found = true
+		if !isLink {
+			return nil
+		}
+
+		// hook runs whatever the link points to, wherever it is
+		// Dangling link is left with link text, its target appearing changes the hash
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil
+		}
+		targetInfo, err := os.Stat(target)
+		if err != nil {
+			return nil
+		}
+		if targetInfo.IsDir() {
+			return walk(target)
+		}
+		return write(target, targetInfo)
+	}
+	walk = func(dir string) error {
+		// links to parent directories would walk forever
+		if visited[dir] {
+			return nil
+		}
+		visited[dir] = true
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if path == dir && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return write(path, info)
+		})
+	}
+
+	if err := walk(filepath.Join(root, "githooks")); err != nil {
+		return "", err
+	}
+
+	for _, name := range []string{"githooks.json", "githooks.lock"} {
+		path := filepath.Join(root, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if err := write(path, info); err != nil {
+			return "", err
+		}
+	}
+
+	// local repos are run in place, like ./tools/hooks, they are part of project hooks
+	// broken config never runs, it's covered by its own content
+	if structure, err := listHooksInConfig(filepath.Join(root, "githooks.json")); err == nil {
+		for _, trigger := range sortedTriggers(structure) {
+			for _, repo := range structure[trigger].Repos {
+				if !repo.isLocal() {
+					continue
+				}
+				for _, hook := range repo.Hooks {
+					path := filepath.Join(repo.dir(""), hook.Name)
+					info, err := os.Lstat(path)
+					if err != nil || info.IsDir() {
+						continue
+					}
+					if err := write(path, info); err != nil {
+						return "", err
+					}
+				}
+			}
+		}
+	}
+
+	if !found {
+		return "", nil
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Whether project hooks are reviewed by `git hooks trust` since they last changed
+// Project without hooks is always trusted
+func isProjectTrusted() bool {
+	hash, err := getProjectHash()
+	if err != nil {
+		return false
+	}
+	if hash == "" {
+		return true
+	}
+
+	trusted, err := gitExec(GIT["TrustedHooks"])
+	return err == nil && trusted == hash
+}
+
+// Trust current project hooks, they run until they change
+func trust() {
+	hash, err := getProjectHash()
+	if err != nil {
+		logger.Errorln(MESSAGES["NotGitRepo"])
+		return
+	}
+	if hash == "" {
+		logger.Infoln(MESSAGES["NoProjectHooks"])
+		return
+	}
+
+	if _, err := gitExec(GIT["TrustHooks"] + hash); err != nil {
+		logger.Errorln(err)
+		return
+	}
+	logger.Infoln(MESSAGES["Trusted"])
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Trust project hooks as they are and run trigger
+func runTrusted(t *testing.T, cmds ...string) {
+	hash, err := getProjectHash()
+	assert.Nil(t, err)
+	if hash != "" {
+		_, err = gitExec(GIT["TrustHooks"] + hash)
+		assert.Nil(t, err)
+	}
+	run(cmds...)
+}
+
+func TestTrust(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		// nothing to trust
+		assert.True(t, isProjectTrusted())
+		trust()
+		assert.Equal(t, MESSAGES["NoProjectHooks"], logger.infos[0])
+		logger.clear()
+
+		createHook(t, "githooks", "pre-commit", "first", `echo first >> run.out`)
+		assert.False(t, isProjectTrusted())
+		run("pre-commit")
+		assert.Equal(t, MESSAGES["Untrusted"], logger.warns[0])
+		isExist, _ := exists("run.out")
+		assert.False(t, isExist)
+		list()
+		assert.Contains(t, logger.infos, "project hooks (untrusted)")
+		logger.clear()
+
+		// no warning for triggers project has no hooks of
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		createHook(t, "global", "post-checkout", "audit", `echo audit >> run.out`)
+		_, err = gitExec("config hooks.global " + filepath.Join(wd, "global"))
+		assert.Nil(t, err)
+		run("post-checkout")
+		assert.Equal(t, 0, len(logger.warns))
+		out, err := ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "audit\n", string(out))
+		os.Remove("run.out")
+		logger.clear()
+
+		trust()
+		assert.Equal(t, MESSAGES["Trusted"], logger.infos[0])
+		assert.True(t, isProjectTrusted())
+		run("pre-commit")
+		assert.Equal(t, 0, len(logger.warns))
+		out, err = ioutil.ReadFile("run.out")
+		assert.Nil(t, err)
+		assert.Equal(t, "first\n", string(out))
+		os.Remove("run.out")
+		logger.clear()
+
+		// changed hook
+		createHook(t, "githooks", "pre-commit", "first", `echo changed >> run.out`)
+		assert.False(t, isProjectTrusted())
+		trust()
+		assert.True(t, isProjectTrusted())
+
+		// new hook, or hook made executable
+		createHook(t, "githooks", "pre-commit", "second", `echo second >> run.out`)
+		assert.False(t, isProjectTrusted())
+		trust()
+		assert.Nil(t, os.Chmod("githooks/pre-commit/second", 0644))
+		assert.False(t, isProjectTrusted())
+		trust()
+
+		// config changed
+		err = ioutil.WriteFile("githooks.json", []byte(`{}`), 0644)
+		assert.Nil(t, err)
+		assert.False(t, isProjectTrusted())
+		trust()
+		assert.True(t, isProjectTrusted())
+
+		// hook of local repo changed
+		createHook(t, "tools", "hooks", "lint", `echo lint >> run.out`)
+		err = ioutil.WriteFile("githooks.json", []byte(`{"pre-commit": {"./tools/hooks": ["lint"]}}`), 0644)
+		assert.Nil(t, err)
+		trust()
+		assert.True(t, isProjectTrusted())
+		createHook(t, "tools", "hooks", "lint", `echo changed >> run.out`)
+		assert.False(t, isProjectTrusted())
+		trust()
+
+		// target of symlink changed
+		createHook(t, "scripts", "pre-commit", "check", `echo check >> run.out`)
+		err = os.Symlink(filepath.Join("..", "..", "scripts", "pre-commit", "check"), filepath.Join("githooks", "pre-commit", "check"))
+		assert.Nil(t, err)
+		assert.False(t, isProjectTrusted())
+		trust()
+		assert.True(t, isProjectTrusted())
+		createHook(t, "scripts", "pre-commit", "check", `echo changed >> run.out`)
+		assert.False(t, isProjectTrusted())
+		trust()
+
+		// directory linked into githooks
+		err = os.Symlink(filepath.Join("..", "scripts", "pre-commit"), filepath.Join("githooks", "pre-push"))
+		assert.Nil(t, err)
+		trust()
+		assert.True(t, isProjectTrusted())
+		createHook(t, "scripts", "pre-commit", "other", `echo other >> run.out`)
+		assert.False(t, isProjectTrusted())
+		trust()
+
+		// link to parent directory
+		err = os.Symlink("..", filepath.Join("githooks", "pre-commit", "parent"))
+		assert.Nil(t, err)
+		trust()
+		assert.True(t, isProjectTrusted())
+
+		// target outside work tree changed
+		outside, err := ioutil.TempDir("", "git-hooks")
+		assert.Nil(t, err)
+		defer os.RemoveAll(outside)
+		createHook(t, outside, "pre-commit", "shared", `echo shared >> run.out`)
+		err = os.Symlink(filepath.Join(outside, "pre-commit", "shared"), filepath.Join("githooks", "pre-commit", "shared"))
+		assert.Nil(t, err)
+		trust()
+		assert.True(t, isProjectTrusted())
+		createHook(t, outside, "pre-commit", "shared", `echo changed >> run.out`)
+		assert.False(t, isProjectTrusted())
+
+		// githooks directory linked outside work tree
+		assert.Nil(t, os.RemoveAll("githooks"))
+		assert.Nil(t, os.Symlink(outside, "githooks"))
+		trust()
+		assert.True(t, isProjectTrusted())
+		createHook(t, outside, "pre-commit", "added", `echo added >> run.out`)
+		assert.False(t, isProjectTrusted())
+		trust()
+
+		// trust is local to clone
+		err = exec.Command("git", "config", "--local", "--unset", "hooks.trusted").Run()
+		assert.Nil(t, err)
+		assert.False(t, isProjectTrusted())
+		logger.clear()
+	})
+}
+
+func TestTrustBareRepo(t *testing.T) {
+	createDirectory(t, os.TempDir(), func(tempdir string) {
+		err := exec.Command("git", "init", "--bare", "-q").Run()
+		assert.Nil(t, err)
+
+		// no work tree, no project hooks
+		hash, err := getProjectHash()
+		assert.Nil(t, err)
+		assert.Equal(t, "", hash)
+		assert.True(t, isProjectTrusted())
+
+		reader, writer, err := os.Pipe()
+		assert.Nil(t, err)
+		defer reader.Close()
+		writer.Close()
+		stdin := os.Stdin
+		os.Stdin = reader
+		defer func() { os.Stdin = stdin }()
+
+		run("pre-receive")
+		assert.Equal(t, 0, len(logger.warns))
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+	})
+}
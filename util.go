@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
@@ -23,6 +25,143 @@ func getGitDirPath() (string, error) {
 	return gitExec("rev-parse --git-dir")
 }
 
+// Absolute path of git dir, `rev-parse --git-dir` may return relative path
+func getAbsGitDirPath() (string, error) {
+	dir, err := getGitDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
+
+// Git dir shared by all worktrees of repo, where hooks and config live
+// It's the git dir itself outside linked worktrees
+func getGitCommonDirPath() (string, error) {
+	return gitExec("rev-parse --git-common-dir")
+}
+
+func getAbsGitCommonDirPath() (string, error) {
+	dir, err := getGitCommonDirPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
+
+// Absolute path of hooks directory git actually use, respect core.hooksPath
+func getHooksDir() (string, error) {
+	root, err := getGitRepoRoot()
+	if err != nil {
+		return "", err
+	}
+
+	hooks, err := gitExecWithDir(root, "rev-parse --git-path hooks")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(hooks) {
+		hooks = filepath.Join(root, hooks)
+	}
+	return hooks, nil
+}
+
+// List staged files, nil if not available
+func getStagedFiles() []string {
+	out, err := gitExec(GIT["StagedFiles"])
+	if err != nil {
+		return nil
+	}
+
+	files := make([]string, 0)
+	for _, file := range strings.Split(out, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Filter files match any of include patterns and none of exclude patterns
+// Empty include patterns match every file
+func filterFiles(files, include, exclude []string) []string {
+	filtered := make([]string, 0)
+	for _, file := range files {
+		if (len(include) == 0 || matchAny(include, file)) && !matchAny(exclude, file) {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Match slash separated path against glob pattern
+// Pattern without slash match base name, like `*.go`
+// `**` match any number of directories, like `vendor/**` or `src/**/*.js`
+func matchGlob(pattern, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := filepath.Match(pattern, path.Base(file))
+		return matched
+	}
+
+	var expr bytes.Buffer
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	matched, _ := regexp.MatchString(expr.String(), file)
+	return matched
+}
+
+// Write files into temporary file separated by NUL
+// Return name of the temporary file
+func writeFileList(files []string) (name string, err error) {
+	file, err := ioutil.TempFile(os.TempDir(), NAME)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	name = file.Name()
+	for _, f := range files {
+		if _, err = file.WriteString(f + "\x00"); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func gitExec(args ...string) (string, error) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -45,6 +184,17 @@ func gitExecWithDir(dir string, args ...string) (string, error) {
 	}
 }
 
+// Execute git command with arguments as is, feed input as stdin
+// Output is returned without trimming
+func gitExecRaw(dir string, input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	return cmd.Output()
+}
+
 func bind(f interface{}, args ...interface{}) func(c *cli.Context) {
 	callable := reflect.ValueOf(f)
 	arguments := make([]reflect.Value, len(args))
@@ -188,6 +338,24 @@ func absExePath(exe string) (name string, err error) {
 	return
 }
 
+// Read all content from stdin like file.
+// Return nil if file is a terminal, nothing is piped in that case
+func readInput(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeCharDevice != 0 {
+		return nil, nil
+	}
+	return ioutil.ReadAll(file)
+}
+
 func isExecutable(info os.FileInfo) bool {
 	return info.Mode()&0111 != 0
 }
+
+// Escape color syntax in text printed by logger
+func escapeColor(text string) string {
+	return strings.Replace(text, "@", "@@", -1)
+}
@@ -102,6 +102,7 @@ func TestAbsExePath(t *testing.T) {
 	// should follow symlic
 	temp, err := ioutil.TempDir(os.TempDir(), "git-hooks-test")
 	assert.Nil(t, err)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
 	os.Setenv("PATH", temp+":$PATH")
 	err = os.Symlink("/bin/ls", filepath.Join(temp, "ls"))
 	assert.Nil(t, err)
@@ -115,3 +116,25 @@ func TestIsExecutable(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, isExecutable(fileinfo))
 }
+
+func TestMatchGlob(t *testing.T) {
+	assert.True(t, matchGlob("*.go", "main.go"))
+	assert.True(t, matchGlob("*.go", "cmd/main.go"))
+	assert.False(t, matchGlob("*.go", "main.go.orig"))
+	assert.True(t, matchGlob("cmd/*.go", "cmd/main.go"))
+	assert.False(t, matchGlob("cmd/*.go", "cmd/sub/main.go"))
+	assert.True(t, matchGlob("vendor/**", "vendor/github.com/lib/lib.go"))
+	assert.True(t, matchGlob("src/**/*.js", "src/index.js"))
+	assert.True(t, matchGlob("src/**/*.js", "src/lib/util/index.js"))
+	assert.False(t, matchGlob("src/**/*.js", "test/index.js"))
+	assert.True(t, matchGlob("docs/?.md", "docs/a.md"))
+	assert.False(t, matchGlob("docs/?.md", "docs/ab.md"))
+}
+
+func TestFilterFiles(t *testing.T) {
+	files := []string{"main.go", "run.sh", "vendor/lib/lib.go"}
+	assert.Equal(t, files, filterFiles(files, nil, nil))
+	assert.Equal(t, []string{"main.go"}, filterFiles(files, []string{"*.go"}, []string{"vendor/**"}))
+	assert.Equal(t, []string{"main.go", "run.sh"}, filterFiles(files, nil, []string{"vendor/**"}))
+	assert.Equal(t, []string{}, filterFiles(files, []string{"*.py"}, nil))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Check checkout of contrib repo against tree, signature and hook hashes in config
+// Hooks of repo failing verification must not run
+func verifyRepo(repo repoConfig, dir string) error {
+	if repo.Tree != "" {
+		tree, err := gitExecWithDir(dir, "rev-parse HEAD^{tree}")
+		if err != nil {
+			return fmt.Errorf("%s: %s is not a git repo", repo, dir)
+		}
+		if tree != repo.Tree {
+			return fmt.Errorf("%s: tree %s doesn't match %s in config", repo, tree, repo.Tree)
+		}
+
+		status, err := gitExecWithDir(dir, "status --porcelain")
+		if err != nil || status != "" {
+			return fmt.Errorf("%s: files in %s are modified", repo, dir)
+		}
+	}
+
+	if repo.Signed {
+		if err := verifySignature(dir, repo.Rev); err != nil {
+			return fmt.Errorf("%s: %s", repo, err)
+		}
+	}
+
+	for _, hook := range repo.Hooks {
+		if hook.Sha256 == "" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, hook.Name))
+		if err != nil {
+			return fmt.Errorf("%s: %s", repo, err)
+		}
+		if hash := fmt.Sprintf("%x", sha256.Sum256(content)); hash != strings.ToLower(hook.Sha256) {
+			return fmt.Errorf("%s: sha256 of %s is %s, doesn't match %s in config", repo, hook.Name, hash, hook.Sha256)
+		}
+	}
+	return nil
+}
+
+// Verify signature of pinned tag, or signature of checked out commit
+// if revision is not an annotated tag
+// Checkout must be the commit of signed tag, locked commit may be another one
+// Signatures are checked against keyring of git config hooks.keyring if configured
+func verifySignature(dir, rev string) error {
+	args := []string{"verify-commit", "HEAD"}
+	if rev != "" {
+		kind, err := gitExecRaw(dir, nil, "cat-file", "-t", rev)
+		if err == nil && strings.TrimSpace(string(kind)) == "tag" {
+			args = []string{"verify-tag", rev}
+
+			commit, err := gitExecRaw(dir, nil, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+			head, headErr := gitExecRaw(dir, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+			if err != nil || headErr != nil || !bytes.Equal(commit, head) {
+				return fmt.Errorf("checkout %s is not commit of signed tag %s",
+					strings.TrimSpace(string(head)), rev)
+			}
+		}
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if keyring := getKeyring(); keyring != "" {
+		cmd.Env = append(os.Environ(), "GNUPGHOME="+keyring)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// GnuPG home directory with trusted keys, by git config hooks.keyring
+// Empty to use default keyring of user
+func getKeyring() string {
+	keyring, err := gitExec("config --get hooks.keyring")
+	if err != nil {
+		return ""
+	}
+	if expanded, err := homedir.Expand(keyring); err == nil {
+		return expanded
+	}
+	return keyring
+}
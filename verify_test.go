@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyHash(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		contrib := filepath.Join(filepath.Dir(origin), "contrib")
+		cloneContribRepo(t, origin, contrib, repoConfig{Name: "github.com/org/hooks", Rev: "v1"})
+
+		tree, _ := gitExecWithDir(origin, "rev-parse v1^{tree}")
+		content, err := ioutil.ReadFile(filepath.Join(origin, "lint"))
+		assert.Nil(t, err)
+		// hook at master, differ from v1
+		hash := fmt.Sprintf("%x", sha256.Sum256(content))
+
+		for config, message := range map[string]string{
+			`{"tree": "` + tree + `", "hooks": ["lint"]}`:                "",
+			`{"tree": "0000", "hooks": ["lint"]}`:                        "doesn't match 0000",
+			`{"hooks": [{"name": "lint", "sha256": "` + hash + `"}]}`:    "sha256 of lint",
+			`{"hooks": [{"name": "missing", "sha256": "` + hash + `"}]}`: "no such file",
+		} {
+			err := ioutil.WriteFile("githooks.json", []byte(`{
+				"pre-commit": {"github.com/org/hooks@v1": `+config+`}
+			}`), 0644)
+			assert.Nil(t, err)
+			os.Remove("run.out")
+
+			r := newRunner(hookConfigs(), "pre-commit", nil)
+			runConfigHooks(r, hookConfigs(), contrib)
+			isExist, _ := exists("run.out")
+			if message == "" {
+				assert.Equal(t, 0, len(logger.errors), config)
+				assert.True(t, isExist, config)
+			} else {
+				assert.True(t, strings.Contains(logger.errors[0].(string), message), config)
+				assert.False(t, isExist, config)
+			}
+			logger.clear()
+		}
+
+		// modified checkout
+		err = ioutil.WriteFile(filepath.Join(contrib, "github.com", "org", "hooks@v1", "lint"), []byte("#!/bin/sh\n"), 0755)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {"github.com/org/hooks@v1": {"tree": "`+tree+`", "hooks": ["lint"]}}
+		}`), 0644)
+		assert.Nil(t, err)
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string), "modified"))
+		logger.clear()
+	})
+}
+
+func TestVerifySignature(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	createGitRepo(t, func(tempdir string) {
+		origin := createContribRepo(t)
+		contrib := filepath.Join(filepath.Dir(origin), "contrib")
+		keyring := filepath.Join(filepath.Dir(origin), "keyring")
+		untrusted := filepath.Join(filepath.Dir(origin), "untrusted")
+		for _, dir := range []string{keyring, untrusted} {
+			assert.Nil(t, os.Mkdir(dir, 0700))
+			defer exec.Command("gpgconf", "--homedir", dir, "--kill", "gpg-agent").Run()
+		}
+
+		cmd := exec.Command("bash", "-c", `
+		gpg --batch --passphrase '' --quick-gen-key 'Hooks <hooks@example.com>' default default never &&
+		git -c user.signingkey=hooks@example.com tag -s -m signed v1-signed v1 &&
+		git tag -a -m unsigned v1-unsigned v1
+		`)
+		cmd.Dir = origin
+		cmd.Env = append(os.Environ(), "GNUPGHOME="+keyring)
+		out, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(out))
+
+		for _, rev := range []string{"v1-signed", "v1-unsigned"} {
+			cloneContribRepo(t, origin, contrib, repoConfig{Name: "github.com/org/hooks", Rev: rev})
+		}
+
+		for _, c := range []struct {
+			rev, keyring string
+			ok           bool
+		}{
+			{"v1-signed", keyring, true},
+			{"v1-signed", untrusted, false},
+			{"v1-unsigned", keyring, false},
+		} {
+			err := exec.Command("git", "config", "hooks.keyring", c.keyring).Run()
+			assert.Nil(t, err)
+			err = ioutil.WriteFile("githooks.json", []byte(`{
+				"pre-commit": {"github.com/org/hooks@`+c.rev+`": {"signed": true, "hooks": ["lint"]}}
+			}`), 0644)
+			assert.Nil(t, err)
+			os.Remove("run.out")
+
+			r := newRunner(hookConfigs(), "pre-commit", nil)
+			runConfigHooks(r, hookConfigs(), contrib)
+			isExist, _ := exists("run.out")
+			assert.Equal(t, c.ok, isExist, c.rev)
+			assert.Equal(t, c.ok, len(logger.errors) == 0, c.rev)
+			logger.clear()
+		}
+
+		// lock edited to another commit, signed tag doesn't cover it
+		err = exec.Command("git", "config", "hooks.keyring", keyring).Run()
+		assert.Nil(t, err)
+		err = ioutil.WriteFile("githooks.json", []byte(`{
+			"pre-commit": {"github.com/org/hooks@v1-signed": {"signed": true, "hooks": ["lint"]}}
+		}`), 0644)
+		assert.Nil(t, err)
+		v2, err := gitExecWithDir(origin, "rev-parse v2")
+		assert.Nil(t, err)
+		err = lockFile{"github.com/org/hooks@v1-signed": v2}.write("githooks.json")
+		assert.Nil(t, err)
+		cloneContribRepo(t, origin, contrib, repoConfig{Name: "github.com/org/hooks", Rev: v2})
+		os.Remove("run.out")
+
+		r := newRunner(hookConfigs(), "pre-commit", nil)
+		runConfigHooks(r, hookConfigs(), contrib)
+		assert.True(t, strings.Contains(logger.errors[0].(string), "is not commit of signed tag v1-signed"))
+		logger.clear()
+	})
+}
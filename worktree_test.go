@@ -0,0 +1,151 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Run shell script in current directory
+func runScript(t *testing.T, script string) {
+	cmd := exec.Command("bash", "-c", "set -e\n"+script)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=CatTail", "GIT_AUTHOR_EMAIL=zhongchiyu@gmail.com",
+		"GIT_COMMITTER_NAME=CatTail", "GIT_COMMITTER_EMAIL=zhongchiyu@gmail.com")
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+}
+
+func TestWorktree(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		runScript(t, `
+		git commit -q --allow-empty -m init
+		git worktree add -q ../worktree-`+filepath.Base(wd)+`
+		`)
+		worktree := filepath.Join(filepath.Dir(wd), "worktree-"+filepath.Base(wd))
+		defer os.RemoveAll(worktree)
+
+		// install from linked worktree lands in common git dir
+		assert.Nil(t, os.Chdir(worktree))
+		commonDir, err := getAbsGitCommonDirPath()
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(wd, ".git"), commonDir)
+		install(true)
+		assert.Equal(t, 0, len(logger.errors))
+		assert.True(t, isShim(filepath.Join(wd, ".git", "hooks", "pre-commit"), tplPostInstall))
+		installed, err := isInstalled()
+		assert.Nil(t, err)
+		assert.True(t, installed)
+		logger.clear()
+
+		// shared by main worktree
+		assert.Nil(t, os.Chdir(wd))
+		installed, err = isInstalled()
+		assert.Nil(t, err)
+		assert.True(t, installed)
+		assert.Equal(t, []string{".git/hooks.old"}, relPaths(t, legacyHookDirs()))
+
+		// hooks fire in linked worktree
+		assert.Nil(t, os.Chdir(worktree))
+		createHook(t, "githooks", "pre-commit", "touch", "touch fired")
+		runTrusted(t, "pre-commit")
+		isExist, _ := exists("fired")
+		assert.True(t, isExist)
+		logger.clear()
+
+		// uninstall from linked worktree
+		install(false)
+		assert.Equal(t, 0, len(logger.errors))
+		isExist, _ = exists(filepath.Join(wd, ".git", "hooks.old"))
+		assert.False(t, isExist)
+		logger.clear()
+
+		// shims of core.hooksPath live in common git dir too
+		installHooksPath(false)
+		assert.Equal(t, filepath.Join(wd, ".git", HOOKS_PATH_DIRNAME), getHooksPath(false))
+		assert.Nil(t, os.Chdir(wd))
+		assert.True(t, isHooksPathInstalled(false))
+		logger.clear()
+	})
+}
+
+func TestSubmodule(t *testing.T) {
+	createGitRepo(t, func(tempdir string) {
+		wd, err := os.Getwd()
+		assert.Nil(t, err)
+		// nested submodule: repo -> sub -> nested
+		runScript(t, `
+		for name in nested sub; do
+			git init -q ../$name-`+filepath.Base(wd)+`
+			git -C ../$name-`+filepath.Base(wd)+` commit -q --allow-empty -m init
+		done
+		cd ../sub-`+filepath.Base(wd)+`
+		git -c protocol.file.allow=always submodule add -q ../nested-`+filepath.Base(wd)+` nested
+		git commit -q -m nested
+		cd - > /dev/null
+		git -c protocol.file.allow=always submodule add -q ../sub-`+filepath.Base(wd)+` sub
+		git -c protocol.file.allow=always submodule update -q --init --recursive
+		`)
+		for _, name := range []string{"nested", "sub"} {
+			defer os.RemoveAll(filepath.Join(filepath.Dir(wd), name+"-"+filepath.Base(wd)))
+		}
+		sub := filepath.Join(wd, "sub")
+		nested := filepath.Join(sub, "nested")
+
+		// .git of submodule is a file
+		info, err := os.Stat(filepath.Join(sub, ".git"))
+		assert.Nil(t, err)
+		assert.False(t, info.IsDir())
+
+		// install inside submodule
+		assert.Nil(t, os.Chdir(sub))
+		install(true)
+		assert.Equal(t, 0, len(logger.errors))
+		assert.True(t, isShim(filepath.Join(wd, ".git", "modules", "sub", "hooks", "pre-commit"), tplPostInstall))
+		installed, err := isInstalled()
+		assert.Nil(t, err)
+		assert.True(t, installed)
+		install(false)
+		logger.clear()
+
+		// install recursively from superproject
+		assert.Nil(t, os.Chdir(wd))
+		installRecursive(func() { install(true) })
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Contains(t, logger.infos, "Install into submodule "+sub)
+		assert.Contains(t, logger.infos, "Install into submodule "+nested)
+		cwd, err := os.Getwd()
+		assert.Nil(t, err)
+		assert.Equal(t, wd, cwd)
+		for _, dir := range []string{wd, sub, nested} {
+			assert.Nil(t, os.Chdir(dir))
+			installed, err := isInstalled()
+			assert.Nil(t, err)
+			assert.True(t, installed, dir)
+		}
+		assert.Nil(t, os.Chdir(wd))
+		logger.clear()
+
+		// run again adds nothing
+		installRecursive(func() { install(true) })
+		assert.Equal(t, 0, len(logger.errors))
+		logger.clear()
+
+		// with core.hooksPath
+		for _, dir := range []string{wd, sub, nested} {
+			assert.Nil(t, os.Chdir(dir))
+			install(false)
+		}
+		assert.Nil(t, os.Chdir(wd))
+		installRecursive(func() { installHooksPath(false) })
+		assert.Equal(t, 0, len(logger.errors))
+		assert.Nil(t, os.Chdir(nested))
+		assert.True(t, isHooksPathInstalled(false))
+		assert.Nil(t, os.Chdir(wd))
+		logger.clear()
+	})
+}